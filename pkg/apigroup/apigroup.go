@@ -1,23 +1,33 @@
 package apigroup
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/obot-platform/kinm/pkg/serializer"
+	"github.com/obot-platform/kinm/pkg/stores"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	runtimeserializer "k8s.io/apimachinery/pkg/runtime/serializer"
-	"k8s.io/apiserver/pkg/registry/rest"
 	genericapiserver "k8s.io/apiserver/pkg/server"
 )
 
 type AddToScheme func(*runtime.Scheme) error
 
-func ForStores(scheme AddToScheme, stores map[string]rest.Storage, groupVersion schema.GroupVersion) (*genericapiserver.APIGroupInfo, error) {
+// ForStores returns the APIGroupInfo of groupVersion, with storages by resource, for instance those of
+// stores.NewCompleteWithStatus. The resource of a subresource must be in storages too.
+func ForStores(scheme AddToScheme, storages stores.Storages, groupVersion schema.GroupVersion) (*genericapiserver.APIGroupInfo, error) {
 	newScheme := runtime.NewScheme()
 	if err := scheme(newScheme); err != nil {
 		return nil, err
 	}
 
-	for _, store := range stores {
+	for path, store := range storages {
+		if resource, subresource, ok := strings.Cut(path, "/"); ok {
+			if _, ok := storages[resource]; !ok {
+				return nil, fmt.Errorf("subresource %s of %s has no storage for %s", subresource, resource, resource)
+			}
+		}
 		newScheme.AddKnownTypes(schema.GroupVersion{
 			Group:   groupVersion.Group,
 			Version: runtime.APIVersionInternal,
@@ -27,7 +37,7 @@ func ForStores(scheme AddToScheme, stores map[string]rest.Storage, groupVersion
 	codecs := runtimeserializer.NewCodecFactory(newScheme)
 	parameterCodec := runtime.NewParameterCodec(newScheme)
 	apiGroupInfo := genericapiserver.NewDefaultAPIGroupInfo(groupVersion.Group, newScheme, parameterCodec, codecs)
-	apiGroupInfo.VersionedResourcesStorageMap[groupVersion.Version] = stores
+	apiGroupInfo.VersionedResourcesStorageMap[groupVersion.Version] = storages
 	if groupVersion.Group != "" {
 		apiGroupInfo.NegotiatedSerializer = serializer.NewNoProtobufSerializer(apiGroupInfo.NegotiatedSerializer)
 	}
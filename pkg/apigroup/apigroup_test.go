@@ -0,0 +1,59 @@
+package apigroup_test
+
+import (
+	"testing"
+
+	"github.com/obot-platform/kinm/pkg/apigroup"
+	"github.com/obot-platform/kinm/pkg/stores"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var testGV = schema.GroupVersion{
+	Group:   "testgroup",
+	Version: "testversion",
+}
+
+type TestKind struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+}
+
+func (t *TestKind) DeepCopyObject() runtime.Object {
+	return &TestKind{
+		TypeMeta:   t.TypeMeta,
+		ObjectMeta: *t.ObjectMeta.DeepCopy(),
+	}
+}
+
+type testStore struct{}
+
+func (testStore) New() runtime.Object {
+	return &TestKind{}
+}
+
+func (testStore) Destroy() {
+}
+
+func addToScheme(scheme *runtime.Scheme) error {
+	scheme.AddKnownTypes(testGV, &TestKind{})
+	return nil
+}
+
+func TestForStores(t *testing.T) {
+	storages := stores.Storages{
+		"testkinds":        testStore{},
+		"testkinds/status": testStore{},
+	}
+	info, err := apigroup.ForStores(addToScheme, storages, testGV)
+	require.NoError(t, err)
+	assert.Len(t, info.VersionedResourcesStorageMap[testGV.Version], 2)
+
+	// A subresource without its resource is rejected
+	delete(storages, "testkinds")
+	_, err = apigroup.ForStores(addToScheme, storages, testGV)
+	assert.Error(t, err)
+}
@@ -0,0 +1,33 @@
+// Package cdc defines the sinks that the changes of a kind are delivered to by a consumer of its change log, see
+// db.Strategy.Consume.
+package cdc
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// Event is a change of an object.
+type Event struct {
+	// ID is the id of the change in the change log of its kind, which is also the resourceVersion of the object.
+	ID         int64           `json:"id"`
+	Type       watch.EventType `json:"type"`
+	APIVersion string          `json:"apiVersion"`
+	Kind       string          `json:"kind"`
+	Object     runtime.Object  `json:"object"`
+}
+
+// Sink receives the changes of a kind in order. A batch that fails to send is sent again, along with any changes
+// after it, so a sink must handle receiving an event more than once.
+type Sink interface {
+	Send(ctx context.Context, events []Event) error
+}
+
+// SinkFunc is a function that implements Sink.
+type SinkFunc func(ctx context.Context, events []Event) error
+
+func (f SinkFunc) Send(ctx context.Context, events []Event) error {
+	return f(ctx, events)
+}
@@ -0,0 +1,42 @@
+package cdc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+)
+
+// NDJSONSink writes each event as a line of JSON.
+type NDJSONSink struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+// NewNDJSONSink returns a sink that writes to w. If w is an *os.File, it is synced after every batch.
+func NewNDJSONSink(w io.Writer) *NDJSONSink {
+	return &NDJSONSink{
+		w: w,
+	}
+}
+
+func (n *NDJSONSink) Send(_ context.Context, events []Event) error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	buf := bufio.NewWriter(n.w)
+	enc := json.NewEncoder(buf)
+	for _, event := range events {
+		if err := enc.Encode(event); err != nil {
+			return err
+		}
+	}
+	if err := buf.Flush(); err != nil {
+		return err
+	}
+	if s, ok := n.w.(interface{ Sync() error }); ok {
+		return s.Sync()
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package cdc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultWebhookAttempts = 5
+	defaultWebhookBackoff  = time.Second
+)
+
+// WebhookOptions configures a WebhookSink. Zero values are replaced with defaults.
+type WebhookOptions struct {
+	// Client is used to send the requests. If nil, http.DefaultClient is used.
+	Client *http.Client
+	// Header is added to every request, for instance, for authentication.
+	Header http.Header
+	// Attempts is the number of times a batch is sent before giving up. If zero, 5 is used.
+	Attempts int
+	// Backoff is the wait before the first retry, it doubles on every retry after. If zero, 1 second is used.
+	Backoff time.Duration
+}
+
+// WebhookSink posts each batch of events to a URL as NDJSON. A batch is retried if the request fails or the
+// response status is 429 or 5xx, any other status that is not 2xx fails the batch.
+type WebhookSink struct {
+	url  string
+	opts WebhookOptions
+}
+
+func NewWebhookSink(url string, opts WebhookOptions) *WebhookSink {
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	if opts.Attempts == 0 {
+		opts.Attempts = defaultWebhookAttempts
+	}
+	if opts.Backoff == 0 {
+		opts.Backoff = defaultWebhookBackoff
+	}
+	return &WebhookSink{
+		url:  url,
+		opts: opts,
+	}
+}
+
+func (w *WebhookSink) Send(ctx context.Context, events []Event) error {
+	var body bytes.Buffer
+	if err := NewNDJSONSink(&body).Send(ctx, events); err != nil {
+		return err
+	}
+
+	backoff := w.opts.Backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := w.post(ctx, body.Bytes())
+		if err == nil || !retry || attempt == w.opts.Attempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post sends body and returns whether the request can be retried if it fails.
+func (w *WebhookSink) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	for k, v := range w.opts.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	resp, err := w.opts.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("webhook %s returned %s", w.url, resp.Status)
+	default:
+		return false, fmt.Errorf("webhook %s returned %s", w.url, resp.Status)
+	}
+}
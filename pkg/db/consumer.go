@@ -0,0 +1,139 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/obot-platform/kinm/pkg/db/cdc"
+	"github.com/obot-platform/kinm/pkg/db/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+const (
+	// consumeBackoff is the wait before the changes are read and sent again after a failure, it doubles on every
+	// failure after, up to maxConsumeBackoff.
+	consumeBackoff    = time.Second
+	maxConsumeBackoff = time.Minute
+)
+
+// Consume delivers the changes of the kind to sink in order, until ctx is done. The cursor of consumer in the change
+// log is stored in the database, so a consumer resumes where it left off when it is restarted. A new consumer starts
+// at the last compaction of the table.
+//
+// Compaction does not pass the cursor of any consumer, so it never removes a change a consumer has not received. A
+// consumer that is no longer used must be removed with RemoveConsumer, or the table is not compacted anymore.
+//
+// Changes are delivered at least once: a batch is sent again if the sink fails, or if the cursor can't be updated
+// after the batch was sent. If the changes after the cursor were compacted anyway, for instance because the consumer
+// was removed and registered again, a ResourceExpired error is returned, since they can't be delivered anymore.
+func (s *Strategy) Consume(ctx context.Context, consumer string, sink cdc.Sink) error {
+	if _, err := s.db.execContext(ctx, s.db.stmt.RegisterCursorSQL(), consumer); err != nil {
+		return err
+	}
+
+	backoff := consumeBackoff
+	for {
+		changed := s.waitChange()
+
+		events, last, err := s.nextChanges(ctx, consumer)
+		if err == nil && len(events) > 0 {
+			if err = sink.Send(ctx, events); err == nil {
+				_, err = s.db.execContext(ctx, s.db.stmt.UpdateCursorSQL(), consumer, last)
+			}
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		if apierrors.IsResourceExpired(err) {
+			return err
+		}
+
+		if err != nil {
+			s.db.logger.Error(ctx, "failed to deliver the changes of %q to consumer %q: %v", s.db.gvk.Kind, consumer, err)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, maxConsumeBackoff)
+			continue
+		}
+
+		backoff = consumeBackoff
+		if len(events) == watchBatchSize {
+			// There may be more changes already
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changed:
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+// RemoveConsumer removes the cursor of consumer, so compaction is no longer held back by it.
+func (s *Strategy) RemoveConsumer(ctx context.Context, consumer string) error {
+	_, err := s.db.execContext(ctx, s.db.stmt.DeleteCursorSQL(), consumer)
+	return err
+}
+
+// nextChanges returns the next batch of changes after the cursor of consumer and the id of the last one.
+func (s *Strategy) nextChanges(ctx context.Context, consumer string) ([]cdc.Event, int64, error) {
+	var cursor int64
+	if err := s.db.queryRowContext(ctx, s.db.stmt.CursorSQL(), consumer).Scan(&cursor); err == sql.ErrNoRows {
+		return nil, 0, fmt.Errorf("consumer %q of %q was removed", consumer, s.db.gvk.Kind)
+	} else if err != nil {
+		return nil, 0, err
+	}
+
+	events, err := s.changesAfter(ctx, nil, cursor)
+	if err != nil || len(events) == 0 {
+		return nil, cursor, err
+	}
+	return events, events[len(events)-1].ID, nil
+}
+
+// changesAfter returns the next batch of changes after cursor, of the objects in namespace, if set. If changes after
+// cursor may have been compacted, it returns a ResourceExpired error.
+func (s *Strategy) changesAfter(ctx context.Context, namespace *string, cursor int64) ([]cdc.Event, error) {
+	meta, records, err := s.db.list(ctx, namespace, nil, cursor, true, 0, watchBatchSize, nil)
+	if err != nil {
+		return nil, err
+	}
+	if cursor < meta.CompactionID {
+		return nil, errors.NewCompactionError(uint(cursor), uint(meta.CompactionID))
+	}
+	if len(records) > watchBatchSize {
+		records = records[:watchBatchSize]
+	}
+
+	events := make([]cdc.Event, 0, len(records))
+	for _, rec := range records {
+		obj := s.New()
+		if err := rec.Unmarshal(obj); err != nil {
+			return nil, err
+		}
+
+		eventType := watch.Modified
+		if rec.created == 1 {
+			eventType = watch.Added
+		} else if rec.deleted == 1 {
+			eventType = watch.Deleted
+		}
+
+		events = append(events, cdc.Event{
+			ID:         rec.id,
+			Type:       eventType,
+			APIVersion: s.db.gvk.GroupVersion().String(),
+			Kind:       s.db.gvk.Kind,
+			Object:     obj,
+		})
+	}
+	return events, nil
+}
@@ -4,23 +4,35 @@ import (
 	"context"
 	"database/sql"
 	_ "embed"
-	"strings"
+	stderrors "errors"
+	"math/rand/v2"
+	"time"
 
-	"github.com/jackc/pgx/v5/pgconn"
-	"github.com/lib/pq"
 	"github.com/obot-platform/kinm/pkg/db/errors"
+	"github.com/obot-platform/kinm/pkg/db/glogrus"
 	"github.com/obot-platform/kinm/pkg/db/statements"
 	kotel "github.com/obot-platform/kinm/pkg/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 type db struct {
-	sqlDB           *sql.DB
+	sqlDB *sql.DB
+	// readDB, if set, is used for read only transactions.
+	readDB          *sql.DB
+	timeouts        Timeouts
+	logger          *glogrus.Logger
 	stmt            *statements.Statements
 	gvk             schema.GroupVersionKind
 	extraFieldNames map[string]int
+	// quotas, if set, are the quotas that writes are checked against.
+	quotas *quotas
+	// watermarks, if set, caches the watermark of the table.
+	watermarks *watermarkCache
 }
 
 func (d *db) Close() {
@@ -28,6 +40,9 @@ func (d *db) Close() {
 }
 
 func (d *db) migrate(ctx context.Context, extraColumnNames, indexFields []string) error {
+	ctx, cancel := withTimeout(ctx, d.timeouts.Migration)
+	defer cancel()
+
 	d.extraFieldNames = make(map[string]int, len(extraColumnNames))
 	for i, name := range extraColumnNames {
 		d.extraFieldNames[name] = i
@@ -38,6 +53,11 @@ func (d *db) migrate(ctx context.Context, extraColumnNames, indexFields []string
 		return err
 	}
 
+	_, err = d.execContext(ctx, d.stmt.SequenceSQL())
+	if err != nil {
+		return err
+	}
+
 	var count int
 	for _, name := range extraColumnNames {
 		// Check if column already exists
@@ -47,27 +67,36 @@ func (d *db) migrate(ctx context.Context, extraColumnNames, indexFields []string
 			continue
 		}
 
-		if _, err = d.execContext(ctx, d.stmt.AddColumnSQL(name)); err != nil {
-			switch e := err.(type) {
-			case *pq.Error:
-				if e.Code == "42701" {
-					continue
-				}
-			case *pgconn.PgError:
-				if e.Code == "42701" {
-					continue
-				}
-			case sqlCode:
-				if e.Code() == 1 && strings.Contains(err.Error(), "duplicate column name") {
-					continue
-				}
-			}
+		if _, err = d.execContext(ctx, d.stmt.AddColumnSQL(name)); err != nil && !d.stmt.Dialect().IsSchemaConflict(err) {
+			return err
+		}
+	}
+
+	// Tables created before the latest column existed need it added and backfilled.
+	if err = d.queryRowContext(ctx, d.stmt.CheckColumnSQL("latest")).Scan(&count); err != nil || count == 0 {
+		if _, err = d.execContext(ctx, d.stmt.AddLatestSQL()); err != nil && !d.stmt.Dialect().IsSchemaConflict(err) {
 			return err
 		}
 	}
 
+	_, err = d.execContext(ctx, d.stmt.LatestIndexSQL())
+	if err != nil && !d.stmt.Dialect().IsSchemaConflict(err) {
+		return err
+	}
+
+	if err = d.queryRowContext(ctx, d.stmt.CheckColumnSQL("expires_at")).Scan(&count); err != nil || count == 0 {
+		if _, err = d.execContext(ctx, d.stmt.AddExpiresAtSQL()); err != nil && !d.stmt.Dialect().IsSchemaConflict(err) {
+			return err
+		}
+	}
+
+	_, err = d.execContext(ctx, d.stmt.ExpiresIndexSQL())
+	if err != nil && !d.stmt.Dialect().IsSchemaConflict(err) {
+		return err
+	}
+
 	_, err = d.execContext(ctx, d.stmt.DropFieldsIndexSQL())
-	if err != nil {
+	if err != nil && !d.stmt.Dialect().IsSchemaConflict(err) {
 		return err
 	}
 
@@ -78,33 +107,157 @@ func (d *db) migrate(ctx context.Context, extraColumnNames, indexFields []string
 	return err
 }
 
+const (
+	// txAttempts is the number of times a transaction is attempted before giving up on contention.
+	txAttempts = 5
+	// txRetryBackoff is the backoff before the first retry, it doubles on every retry after.
+	txRetryBackoff = 10 * time.Millisecond
+)
+
 type txKey struct{}
 
-func (d *db) execContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
-	if query == "" {
+// txState is the state of the outermost transaction, shared by the operations nested in it.
+type txState struct {
+	onCommit []func()
+}
+
+type txStateKey struct{}
+
+// withoutTx returns a context with the values of ctx, but outside its transaction.
+func withoutTx(ctx context.Context) context.Context {
+	return context.WithValue(context.WithValue(ctx, txKey{}, nil), txStateKey{}, nil)
+}
+
+// onCommit runs fn once the transaction of ctx commits, or right away if ctx is not in a transaction. If the
+// transaction rolls back, fn is not run.
+func onCommit(ctx context.Context, fn func()) {
+	if state, ok := ctx.Value(txStateKey{}).(*txState); ok {
+		state.onCommit = append(state.onCommit, fn)
+		return
+	}
+	fn()
+}
+
+func (d *db) execContext(ctx context.Context, stmt statements.Statement, args ...any) (sql.Result, error) {
+	if stmt.SQL == "" {
 		return nil, nil
 	}
+
+	ctx, done := d.observe(ctx, stmt)
+
+	var (
+		result sql.Result
+		err    error
+	)
 	tx, ok := ctx.Value(txKey{}).(*sql.Tx)
 	if ok {
-		return tx.ExecContext(ctx, query, args...)
+		result, err = tx.ExecContext(ctx, stmt.SQL, stmt.Args(args...)...)
+	} else {
+		result, err = d.sqlDB.ExecContext(ctx, stmt.SQL, stmt.Args(args...)...)
+	}
+
+	var affected int64
+	if err == nil {
+		affected, _ = result.RowsAffected()
 	}
-	return d.sqlDB.ExecContext(ctx, query, args...)
+	done(affected, err)
+	return result, err
 }
 
-func (d *db) queryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+func (d *db) queryContext(ctx context.Context, stmt statements.Statement, args ...any) (*rows, error) {
+	ctx, done := d.observe(ctx, stmt)
+
+	var (
+		result *sql.Rows
+		err    error
+	)
 	tx, ok := ctx.Value(txKey{}).(*sql.Tx)
 	if ok {
-		return tx.QueryContext(ctx, query, args...)
+		result, err = tx.QueryContext(ctx, stmt.SQL, stmt.Args(args...)...)
+	} else {
+		result, err = d.sqlDB.QueryContext(ctx, stmt.SQL, stmt.Args(args...)...)
+	}
+	if err != nil {
+		done(0, err)
+		return nil, err
 	}
-	return d.sqlDB.QueryContext(ctx, query, args...)
+	return &rows{Rows: result, done: done}, nil
 }
 
-func (d *db) queryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+// queryRowContext runs a statement that returns a single row. The statement is reported once it has run, whether or
+// not the row is scanned, so the number of rows is unknown.
+func (d *db) queryRowContext(ctx context.Context, stmt statements.Statement, args ...any) *sql.Row {
+	ctx, done := d.observe(ctx, stmt)
+
+	var result *sql.Row
 	tx, ok := ctx.Value(txKey{}).(*sql.Tx)
 	if ok {
-		return tx.QueryRowContext(ctx, query, args...)
+		result = tx.QueryRowContext(ctx, stmt.SQL, stmt.Args(args...)...)
+	} else {
+		result = d.sqlDB.QueryRowContext(ctx, stmt.SQL, stmt.Args(args...)...)
+	}
+	done(-1, result.Err())
+	return result
+}
+
+// observe starts a span for the statement. The returned function must be called with the number of rows
+// read or affected once the statement is done, it logs the statement and ends the span.
+func (d *db) observe(ctx context.Context, stmt statements.Statement) (context.Context, func(rows int64, err error)) {
+	ctx, span := kotel.StartSpanLevelIfParent(ctx, tracer, kotel.LevelVerbose, "dbStatement", trace.WithAttributes(attribute.String("statement", stmt.Name)))
+	begin := time.Now()
+	return ctx, func(rows int64, err error) {
+		defer span.End()
+		if rows >= 0 {
+			span.SetAttributes(attribute.Int64("rows", rows))
+		}
+		expected := d.expectedError(err)
+		if err != nil {
+			span.RecordError(err)
+			if !expected {
+				span.SetStatus(codes.Error, err.Error())
+			}
+		}
+		if d.logger != nil {
+			d.logger.TraceStatement(ctx, stmt.Name, begin, func() (string, int64) {
+				return stmt.SQL, rows
+			}, err, expected)
+		}
+	}
+}
+
+// expectedError returns true if err is handled by the caller of the statement: unique violations are returned as
+// conflicts, schema conflicts are ignored by migrations, and transactions that fail on contention are retried.
+func (d *db) expectedError(err error) bool {
+	dialect := d.stmt.Dialect()
+	return err != nil && (dialect.IsDuplicateKey(err) ||
+		dialect.IsSchemaConflict(err) ||
+		dialect.IsRetryable(err) ||
+		dialect.IsLockTimeout(err) ||
+		stderrors.Is(err, context.Canceled))
+}
+
+// rows counts the rows read and reports them when closed.
+type rows struct {
+	*sql.Rows
+	count int64
+	done  func(rows int64, err error)
+}
+
+func (r *rows) Next() bool {
+	if r.Rows.Next() {
+		r.count++
+		return true
 	}
-	return d.sqlDB.QueryRowContext(ctx, query, args...)
+	return false
+}
+
+func (r *rows) Close() error {
+	err := r.Rows.Close()
+	if r.done != nil {
+		r.done(r.count, r.Rows.Err())
+		r.done = nil
+	}
+	return err
 }
 
 type tx interface {
@@ -128,15 +281,119 @@ func (d *db) beginTx(ctx context.Context, options *sql.TxOptions) (context.Conte
 		// don't actually nest transactions
 		return ctx, noopTx{}, nil
 	}
-	tx, err := d.sqlDB.BeginTx(ctx, options)
+	sqlDB := d.sqlDB
+	if d.readDB != nil && options != nil && options.ReadOnly {
+		sqlDB = d.readDB
+	}
+	if options != nil {
+		options = &sql.TxOptions{
+			Isolation: d.stmt.Dialect().Isolation(options.Isolation),
+			ReadOnly:  options.ReadOnly,
+		}
+	}
+	tx, err := sqlDB.BeginTx(ctx, options)
 	if err != nil {
 		return ctx, nil, err
 	}
+	ctx = context.WithValue(ctx, txStateKey{}, &txState{})
 	return context.WithValue(ctx, txKey{}, tx), tx, nil
 }
 
+// inTx runs fn in a transaction and commits it if fn succeeds. If the transaction fails because of contention
+// with another transaction, it is retried from the start with backoff. Nested calls run in the outer transaction
+// and are not retried on their own, the outermost call is retried instead.
+func (d *db) inTx(ctx context.Context, options *sql.TxOptions, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
+	backoff := txRetryBackoff
+	for attempt := 1; ; attempt++ {
+		err := d.tryTx(ctx, options, fn)
+		if err == nil || !d.stmt.Dialect().IsRetryable(err) {
+			return errors.FromTimeout(d.stmt.Dialect(), err)
+		}
+		if attempt == txAttempts {
+			return errors.NewTooManyRequests(err)
+		}
+
+		trace.SpanFromContext(ctx).SetAttributes(attribute.Int("retries", attempt))
+
+		select {
+		case <-ctx.Done():
+			return errors.FromTimeout(d.stmt.Dialect(), err)
+		case <-time.After(backoff/2 + rand.N(backoff/2)):
+		}
+		backoff *= 2
+	}
+}
+
+func (d *db) tryTx(ctx context.Context, options *sql.TxOptions, fn func(ctx context.Context) error) error {
+	ctx, tx, err := d.beginTx(ctx, options)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	restore := func() error { return nil }
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout := time.Until(deadline)
+		if timeout <= 0 {
+			return context.DeadlineExceeded
+		}
+		if restore, err = d.setTimeout(ctx, timeout); err != nil {
+			return err
+		}
+	}
+
+	if err := fn(ctx); err != nil {
+		_ = restore()
+		return err
+	}
+	if err := restore(); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if state, ok := ctx.Value(txStateKey{}).(*txState); ok {
+		for _, fn := range state.onCommit {
+			fn()
+		}
+	}
+	return nil
+}
+
+// setTimeout bounds the statements of the transaction of ctx by timeout. The returned function restores the setting
+// the connection had before, if it outlives the transaction, and must be called before the transaction ends.
+func (d *db) setTimeout(ctx context.Context, timeout time.Duration) (restore func() error, _ error) {
+	restore = func() error { return nil }
+	if stmt := d.stmt.SessionTimeoutSQL(); stmt.SQL != "" {
+		var previous int64
+		if err := d.queryRowContext(ctx, stmt).Scan(&previous); err != nil {
+			return nil, err
+		}
+		restore = func() error {
+			// The setting is restored even if ctx is done. If the transaction already rolled back because of it,
+			// its connection was closed.
+			_, err := d.execContext(context.WithoutCancel(ctx), d.stmt.RestoreTimeoutSQL(previous))
+			return err
+		}
+	}
+	if _, err := d.execContext(ctx, d.stmt.TimeoutSQL(timeout)); err != nil {
+		return nil, err
+	}
+	return restore, nil
+}
+
 func (d *db) get(ctx context.Context, namespace, name string) (*record, error) {
-	_, records, err := d.list(ctx, getNamespace(namespace), &name, 0, false, 0, 1, nil)
+	ctx, cancel := withTimeout(ctx, d.timeouts.Get)
+	defer cancel()
+
+	// A get is not bound by the watermark so that a write is always visible to the next read of the same object.
+	_, records, err := d.read(ctx, getNamespace(namespace), &name, 0, false, 0, 1, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -146,22 +403,42 @@ func (d *db) get(ctx context.Context, namespace, name string) (*record, error) {
 	return &records[0], nil
 }
 
+// lockLatest returns the latest revision of an object and locks it until the transaction of ctx ends, so that the
+// object can't be updated until then.
+func (d *db) lockLatest(ctx context.Context, namespace, name string) (*record, error) {
+	ctx, cancel := withTimeout(ctx, d.timeouts.Get)
+	defer cancel()
+
+	rec := record{name: name, namespace: namespace}
+	err := d.queryRowContext(ctx, d.stmt.LockLatestSQL(), namespace, name).Scan(&rec.id, &rec.deleted, &rec.value)
+	if stderrors.Is(err, sql.ErrNoRows) || (err == nil && rec.deleted == 1) {
+		return nil, errors.NewNotFound(d.gvk, name)
+	} else if err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
 type tableMeta struct {
 	ListID       int64
 	CompactionID int64
 }
 
 // list after=true will return all records after rev, whereas after=false it will return just the latest resourceVersion
-// for each name,namespace pair for all records <= rev
+// for each name,namespace pair for all records <= rev. When after=true, a non-zero cont is the upper bound (inclusive)
+// of the records returned, so that a change log can be paged through at a fixed resourceVersion.
 func (d *db) list(ctx context.Context, namespace, name *string, rev int64, after bool, cont, limit int64, fieldSelector fields.Selector) (tableMeta, []record, error) {
 	ctx, span := kotel.StartSpanLevelIfParent(ctx, tracer, kotel.LevelVerbose, "dbList")
 	defer span.End()
 
-	if cont > 0 && rev <= 0 {
+	ctx, cancel := withTimeout(ctx, d.timeouts.List)
+	defer cancel()
+
+	if !after && cont > 0 && rev <= 0 {
 		panic("rev must be set when cont is set")
 	}
-	if after && cont != 0 {
-		panic("cont must be zero when after is true")
+	if after && cont != 0 && cont < rev {
+		panic("cont must not be less than rev when after is true")
 	}
 
 	vals := make([]any, len(d.extraFieldNames))
@@ -173,37 +450,31 @@ func (d *db) list(ctx context.Context, namespace, name *string, rev int64, after
 		}
 	}
 
-	ctx, tx, err := d.beginTx(ctx, &sql.TxOptions{
-		// Repeatable read is needed to ensure that the ListID is consistent across multiple queries
-		Isolation: sql.LevelRepeatableRead,
-		ReadOnly:  true,
-	})
-	if err != nil {
-		return tableMeta{}, nil, err
+	// The latest state and the head of the change log are bound by the watermark. Otherwise, the returned
+	// ListID could be greater than the id of a write that has not committed yet, and a watch started from
+	// it would never see that write.
+	readRev, readCont := rev, cont
+	if (!after && rev == 0) || (after && cont == 0) {
+		watermark, ok, err := d.watermark(ctx)
+		if err != nil {
+			return tableMeta{}, nil, errors.FromTimeout(d.stmt.Dialect(), err)
+		}
+		if ok && after {
+			readCont = max(rev, watermark)
+		} else if ok {
+			readRev = watermark
+		}
+		if ok && readRev == 0 && readCont == 0 {
+			// Nothing that is safe to read has been committed yet
+			return tableMeta{}, nil, nil
+		}
 	}
-	defer func() {
-		_ = tx.Rollback()
-	}()
 
-	meta, records, err := d.doList(ctx, namespace, name, rev, after, cont, limit, vals)
+	meta, records, err := d.read(ctx, namespace, name, readRev, after, readCont, limit, vals)
 	if err != nil {
 		return tableMeta{}, nil, err
 	}
 
-	if rev > 0 && !after {
-		// Set the ListID to the requested revision
-		meta.ListID = rev
-	}
-
-	// this can possibly be zero if when no results were found. Also notice the isolation is repeatable read
-	// so that we will get the same ID that was used in the first query
-	if meta.ListID == 0 {
-		meta, err = d.getTableMeta(ctx)
-		if err != nil {
-			return tableMeta{}, nil, err
-		}
-	}
-
 	// ListID can be zero if no records exist in the table. Also don't check if rev is zero that means
 	// a specific revision was not requested and there we don't need to consider compaction. This condition
 	// is important for when the compaction ID is greater than any existing ID in the table. That can happen
@@ -212,7 +483,81 @@ func (d *db) list(ctx context.Context, namespace, name *string, rev int64, after
 		return meta, nil, errors.NewCompactionError(uint(meta.ListID), uint(meta.CompactionID))
 	}
 
-	return meta, records, tx.Commit()
+	return meta, records, nil
+}
+
+// read returns the records for the list without applying the watermark.
+func (d *db) read(ctx context.Context, namespace, name *string, rev int64, after bool, cont, limit int64, vals []any) (meta tableMeta, records []record, _ error) {
+	return meta, records, d.inTx(ctx, &sql.TxOptions{
+		// Repeatable read is needed to ensure that the ListID is consistent across multiple queries
+		Isolation: sql.LevelRepeatableRead,
+		ReadOnly:  true,
+	}, func(ctx context.Context) (err error) {
+		// The latest revisions can be read directly unless an older revision was requested.
+		latest := !after && rev == 0
+		if !after && rev > 0 {
+			meta, err = d.getTableMeta(ctx)
+			if err != nil {
+				return err
+			}
+			latest = meta.ListID <= rev
+		}
+
+		meta, records, err = d.doList(ctx, namespace, name, rev, after, latest, cont, limit, vals)
+		if err != nil {
+			return err
+		}
+
+		if rev > 0 && !after {
+			// Set the ListID to the requested revision
+			meta.ListID = rev
+		} else if after && cont > 0 {
+			// Set the ListID to the upper bound of the page
+			meta.ListID = cont
+		}
+
+		// this can possibly be zero if when no results were found. Also notice the isolation is repeatable read
+		// so that we will get the same ID that was used in the first query
+		if meta.ListID == 0 {
+			meta, err = d.getTableMeta(ctx)
+		}
+		return err
+	})
+}
+
+// watermark returns the highest id at or below which every write has either committed or rolled back. The bool
+// is false if ids are always committed in order, in which case no watermark is needed.
+func (d *db) watermark(ctx context.Context) (int64, bool, error) {
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok || d.stmt.SequenceValueSQL().SQL == "" {
+		// Reads within a transaction see that transaction's writes, so they are not bound either.
+		return 0, false, nil
+	}
+	if d.watermarks != nil {
+		return d.watermarks.get(func() (int64, bool, error) {
+			return d.readWatermark(ctx)
+		})
+	}
+	return d.readWatermark(ctx)
+}
+
+// readWatermark reads the watermark from the database.
+func (d *db) readWatermark(ctx context.Context) (int64, bool, error) {
+	// The sequence must be read before the pending writers. A writer that is not pending yet is guaranteed
+	// to be allocated an id greater than the value read here.
+	var last int64
+	if err := d.queryRowContext(ctx, d.stmt.SequenceValueSQL()).Scan(&last); err != nil {
+		return 0, false, err
+	}
+
+	var pending sql.NullInt64
+	if err := d.queryRowContext(ctx, d.stmt.PendingWritesSQL(), last).Scan(&pending); err != nil {
+		return 0, false, err
+	}
+
+	if pending.Valid && pending.Int64 < last {
+		return pending.Int64, true, nil
+	}
+	return last, true, nil
 }
 
 func (d *db) getTableMeta(ctx context.Context) (meta tableMeta, _ error) {
@@ -220,9 +565,11 @@ func (d *db) getTableMeta(ctx context.Context) (meta tableMeta, _ error) {
 	return meta, err
 }
 
-func (d *db) doList(ctx context.Context, namespace, name *string, rev int64, after bool, cont, limit int64, vals []any) (meta tableMeta, _ []record, _ error) {
+// doList with latest=true reads from the latest revision of each name,namespace pair directly, which is only
+// correct if rev is zero or no newer revision exists.
+func (d *db) doList(ctx context.Context, namespace, name *string, rev int64, after, latest bool, cont, limit int64, vals []any) (meta tableMeta, _ []record, _ error) {
 	var (
-		rows *sql.Rows
+		rows *rows
 		err  error
 	)
 	if vals == nil {
@@ -232,8 +579,11 @@ func (d *db) doList(ctx context.Context, namespace, name *string, rev int64, aft
 	}
 
 	if after {
-		vals = append([]any{namespace, name, rev}, vals...)
+		vals = append([]any{namespace, name, rev, cont}, vals...)
 		rows, err = d.queryContext(ctx, d.stmt.ListAfterSQL(limit), vals...)
+	} else if latest {
+		vals = append([]any{namespace, name, cont}, vals...)
+		rows, err = d.queryContext(ctx, d.stmt.ListLatestSQL(limit), vals...)
 	} else {
 		vals = append([]any{namespace, name, rev, cont}, vals...)
 		rows, err = d.queryContext(ctx, d.stmt.ListSQL(limit), vals...)
@@ -263,34 +613,38 @@ func (d *db) doList(ctx context.Context, namespace, name *string, rev int64, aft
 	return meta, records, nil
 }
 
-func (d *db) insert(ctx context.Context, rec record) (id int64, _ error) {
-	ctx, span := kotel.StartSpanLevelIfParent(ctx, tracer, kotel.LevelVerbose, "dbInsert")
-	defer span.End()
-
-	ctx, tx, err := d.beginTx(ctx, &sql.TxOptions{
-		Isolation: sql.LevelRepeatableRead,
-	})
+// expired returns the latest revisions of up to limit objects that expired at or before now.
+func (d *db) expired(ctx context.Context, now time.Time, limit int64) ([]record, error) {
+	rows, err := d.queryContext(ctx, d.stmt.ExpiredSQL(limit), now.Unix())
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	defer func() {
-		_ = tx.Rollback()
-	}()
+	defer rows.Close()
 
-	id, err = d.doInsert(ctx, rec)
-	if err != nil {
-		return 0, err
+	var records []record
+	for rows.Next() {
+		var r record
+		if err := rows.Scan(&r.id, &r.name, &r.namespace, &r.previousID, &r.uid, &r.created, &r.deleted, &r.value); err != nil {
+			return nil, err
+		}
+		records = append(records, r)
 	}
-
-	return id, tx.Commit()
+	return records, rows.Err()
 }
 
-type sqlError interface {
-	SQLState() string
-}
+func (d *db) insert(ctx context.Context, rec record) (id int64, _ error) {
+	ctx, span := kotel.StartSpanLevelIfParent(ctx, tracer, kotel.LevelVerbose, "dbInsert")
+	defer span.End()
 
-type sqlCode interface {
-	Code() int
+	ctx, cancel := withTimeout(ctx, d.timeouts.Insert)
+	defer cancel()
+
+	return id, d.inTx(ctx, &sql.TxOptions{
+		Isolation: sql.LevelRepeatableRead,
+	}, func(ctx context.Context) (err error) {
+		id, err = d.doInsert(ctx, rec)
+		return err
+	})
 }
 
 func (d *db) doInsert(ctx context.Context, rec record) (id int64, err error) {
@@ -300,7 +654,7 @@ func (d *db) doInsert(ctx context.Context, rec record) (id int64, err error) {
 		panic("vals must have the same length as extraFieldNames")
 	}
 
-	_, err = d.execContext(ctx, d.stmt.TableLockSQL())
+	_, err = d.execContext(ctx, d.stmt.WriteLockSQL())
 	if err != nil {
 		return 0, err
 	}
@@ -315,6 +669,12 @@ func (d *db) doInsert(ctx context.Context, rec record) (id int64, err error) {
 		panic("previousID must be set when created is false")
 	}
 
+	// The objects and bytes the write adds to the usage of the namespace
+	objects, bytes := int64(0), int64(len(rec.value))
+	if rec.created == 1 {
+		objects = 1
+	}
+
 	// only check on update, on create DB constraints errors
 	if rec.created == 0 {
 		existing, err := d.get(ctx, rec.namespace, rec.name)
@@ -326,9 +686,30 @@ func (d *db) doInsert(ctx context.Context, rec record) (id int64, err error) {
 			return 0, errors.NewResourceVersionMismatch(d.gvk, rec.name)
 		} else if existing.uid != rec.uid {
 			return 0, errors.NewUIDMismatch(rec.name, existing.uid, rec.uid)
-		} else if rec.deleted == 0 && existing.value == rec.value {
+		}
+
+		if rec.encode != nil {
+			if rec.value, err = rec.encode(*existing); err != nil {
+				return 0, err
+			}
+		}
+		if rec.deleted == 0 && existing.value == rec.value {
 			return existing.id, nil
 		}
+
+		bytes = int64(len(rec.value)) - int64(len(existing.value))
+		if rec.deleted == 1 {
+			objects, bytes = -1, -int64(len(existing.value))
+		}
+	}
+
+	if err := d.chargeQuota(ctx, rec.namespace, rec.name, objects, bytes); err != nil {
+		return 0, err
+	}
+
+	_, err = d.execContext(ctx, d.stmt.ClearLatestSQL(), rec.namespace, rec.name)
+	if err != nil {
+		return 0, err
 	}
 
 	var createdAny any
@@ -336,31 +717,34 @@ func (d *db) doInsert(ctx context.Context, rec record) (id int64, err error) {
 		createdAny = 1
 	}
 
-	args := append([]any{rec.name, rec.namespace, rec.previousID, rec.uid, createdAny, rec.deleted, rec.value}, rec.vals...)
-	err = d.queryRowContext(ctx, d.stmt.InsertSQL(), args...).Scan(&id)
-	if pgErr, ok := err.(sqlError); ok && pgErr.SQLState() == "23505" {
-		return 0, errors.NewAlreadyExists(d.gvk, rec.name)
-	} else if sqliteErr, ok := err.(sqlCode); ok && sqliteErr.Code() == 2067 {
+	args := append([]any{rec.name, rec.namespace, rec.previousID, rec.uid, createdAny, rec.deleted, rec.value, rec.expiresAt}, rec.vals...)
+	if d.stmt.Dialect().LastInsertID() {
+		var result sql.Result
+		if result, err = d.execContext(ctx, d.stmt.InsertSQL(), args...); err == nil {
+			id, err = result.LastInsertId()
+		}
+	} else {
+		err = d.queryRowContext(ctx, d.stmt.InsertSQL(), args...).Scan(&id)
+	}
+	if d.stmt.Dialect().IsDuplicateKey(err) {
+		if rec.created == 0 {
+			// A concurrent update of the same object committed first
+			return 0, errors.NewResourceVersionMismatch(d.gvk, rec.name)
+		}
 		return 0, errors.NewAlreadyExists(d.gvk, rec.name)
 	} else if err != nil {
 		return 0, err
 	}
+	onCommit(ctx, d.watermarks.invalidate)
 	return
 }
 
-func (d *db) delete(ctx context.Context, r record) (int64, error) {
+func (d *db) delete(ctx context.Context, r record) (id int64, _ error) {
 	ctx, span := kotel.StartSpanLevelIfParent(ctx, tracer, kotel.LevelVerbose, "dbDelete")
 	defer span.End()
 
-	ctx, tx, err := d.beginTx(ctx, &sql.TxOptions{
-		Isolation: sql.LevelRepeatableRead,
-	})
-	if err != nil {
-		return 0, err
-	}
-	defer func() {
-		_ = tx.Rollback()
-	}()
+	ctx, cancel := withTimeout(ctx, d.timeouts.Insert)
+	defer cancel()
 
 	if r.previousID == nil {
 		panic("previousID must be set")
@@ -368,22 +752,28 @@ func (d *db) delete(ctx context.Context, r record) (int64, error) {
 
 	r.created = 0
 	r.deleted = 1
+	r.expiresAt = nil
 
-	id, err := d.doInsert(ctx, r)
-	if err != nil {
-		return 0, err
-	}
-
-	if _, err := d.execContext(ctx, d.stmt.ClearCreatedSQL(), r.namespace, r.name, id); err != nil {
-		return 0, err
-	}
+	return id, d.inTx(ctx, &sql.TxOptions{
+		Isolation: sql.LevelRepeatableRead,
+	}, func(ctx context.Context) (err error) {
+		id, err = d.doInsert(ctx, r)
+		if err != nil {
+			return err
+		}
 
-	return id, tx.Commit()
+		_, err = d.execContext(ctx, d.stmt.ClearCreatedSQL(), r.namespace, r.name, id)
+		return err
+	})
 }
 
 func (d *db) compact(ctx context.Context) (resultCount int64, _ error) {
 	ctx, span := kotel.StartSpanLevelIfParent(ctx, tracer, kotel.LevelVerbose, "dbCompact")
 	defer span.End()
+
+	ctx, cancel := withTimeout(ctx, d.timeouts.Compaction)
+	defer cancel()
+
 	for {
 		result, err := d.execContext(ctx, d.stmt.CompactSQL())
 		if err != nil {
@@ -398,6 +788,25 @@ func (d *db) compact(ctx context.Context) (resultCount int64, _ error) {
 		}
 	}
 
-	_, err := d.execContext(ctx, d.stmt.UpdateCompactionSQL())
+	// The compaction ID must not pass the watermark, otherwise a write that commits later with a lower id
+	// would be behind the compaction ID.
+	watermark, ok, err := d.watermark(ctx)
+	if err != nil {
+		return resultCount, err
+	}
+
+	// Nor must it pass the cursor of a consumer of the change log, which has yet to read the changes after it.
+	var cursor sql.NullInt64
+	if err := d.queryRowContext(ctx, d.stmt.MinCursorSQL()).Scan(&cursor); err != nil {
+		return resultCount, err
+	}
+	if cursor.Valid && (!ok || cursor.Int64 < watermark) {
+		watermark, ok = cursor.Int64, true
+	}
+	if ok && watermark == 0 {
+		return resultCount, nil
+	}
+
+	_, err = d.execContext(ctx, d.stmt.UpdateCompactionSQL(), watermark)
 	return resultCount, err
 }
@@ -3,18 +3,28 @@ package db
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	_ "github.com/glebarez/go-sqlite"
+	"github.com/go-sql-driver/mysql"
 	_ "github.com/lib/pq"
+	"github.com/obot-platform/kinm/pkg/db/glogrus"
 	"github.com/obot-platform/kinm/pkg/db/statements"
+	"github.com/sirupsen/logrus"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apiserver/pkg/storage"
 )
 
@@ -31,17 +41,20 @@ func newDatabase(t *testing.T) *db {
 
 	extraFields := []string{"field.selector"}
 
-	sqldb, lock := newSQLDB(t)
-	_, err := sqldb.ExecContext(context.Background(), "DROP TABLE IF EXISTS recordstest")
-	require.NoError(t, err)
+	sqldb, dialect := newSQLDB(t)
+	dropTable(t, sqldb, "recordstest", dialect)
 	s := &db{
 		sqlDB: sqldb,
-		stmt:  statements.New("recordstest", extraFields, lock),
+		stmt:  statements.New(dialect, "recordstest", extraFields),
 		gvk:   testGVK,
 	}
 	require.NoError(t, s.migrate(context.Background(), extraFields, extraFields))
 	insertRows(t, s)
-	_, err = sqldb.Exec("INSERT INTO compaction(name, id) values('recordstest', 1) ON CONFLICT(name) DO UPDATE SET id = 1")
+	upsert := "INSERT INTO compaction(name, id) values('recordstest', 1) ON CONFLICT(name) DO UPDATE SET id = 1"
+	if dialect == statements.MySQL {
+		upsert = "INSERT INTO compaction(name, id) values('recordstest', 1) ON DUPLICATE KEY UPDATE id = 1"
+	}
+	_, err := sqldb.Exec(upsert)
 	require.NoError(t, err)
 
 	// Migrating a second time should succeed, drop the indexes because we don't need them.
@@ -49,21 +62,40 @@ func newDatabase(t *testing.T) *db {
 	return s
 }
 
-func newSQLDB(t *testing.T) (*sql.DB, bool) {
+func dropTable(t *testing.T, sqldb *sql.DB, name string, dialect statements.Dialect) {
+	t.Helper()
+
+	_, err := sqldb.ExecContext(context.Background(), "DROP TABLE IF EXISTS "+name)
+	require.NoError(t, err)
+	if dialect == statements.Postgres {
+		_, err = sqldb.ExecContext(context.Background(), "DROP SEQUENCE IF EXISTS "+name+"_id_seq")
+		require.NoError(t, err)
+	}
+}
+
+func newSQLDB(t *testing.T) (*sql.DB, statements.Dialect) {
 	t.Helper()
 
 	var (
-		err  error
-		lock bool
-		db   *sql.DB
+		err     error
+		dialect statements.Dialect
+		db      *sql.DB
 	)
-	if os.Getenv("KINM_TEST_DB") == "postgres" {
-		lock = true
+	switch os.Getenv("KINM_TEST_DB") {
+	case "postgres":
+		dialect = statements.Postgres
 		psqlInfo := fmt.Sprintf("host=%s port=%d user=%s "+
 			"password=%s dbname=%s sslmode=disable",
 			host, port, user, password, dbname)
 		db, err = sql.Open("postgres", psqlInfo)
-	} else {
+	case "cockroachdb":
+		dialect = statements.CockroachDB
+		db, err = sql.Open("postgres", fmt.Sprintf("host=%s port=26257 user=root dbname=defaultdb sslmode=disable", host))
+	case "mysql":
+		dialect = statements.MySQL
+		db, err = sql.Open("mysql", mysqlDSN(fmt.Sprintf("%s:%s@tcp(%s:3306)/%s", user, password, host, dbname)))
+	default:
+		dialect = statements.SQLite
 		db, err = sql.Open("sqlite", "otto.db")
 		db.SetMaxOpenConns(1)
 	}
@@ -79,13 +111,92 @@ func newSQLDB(t *testing.T) (*sql.DB, bool) {
 		t.Fatal(err)
 	}
 
-	return db, lock
+	return db, dialect
+}
+
+// newTestFactory returns a Factory on the database selected by KINM_TEST_DB. On SQLite every test gets a database of
+// its own, on the other databases the tables of the kinds of schema, and the rows they own in the shared tables, are
+// dropped first.
+func newTestFactory(t *testing.T, schema *runtime.Scheme, opts FactoryOptions) *Factory {
+	t.Helper()
+
+	var dsn string
+	switch os.Getenv("KINM_TEST_DB") {
+	case "postgres":
+		dsn = fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable", user, password, host, port, dbname)
+	case "cockroachdb":
+		dsn = fmt.Sprintf("cockroachdb://root@%s:26257/defaultdb?sslmode=disable", host)
+	case "mysql":
+		dsn = fmt.Sprintf("mysql://%s:%s@tcp(%s:3306)/%s", user, password, host, dbname)
+	default:
+		dsn = "sqlite://" + filepath.Join(t.TempDir(), "kinm.db")
+	}
+
+	f, err := NewFactoryWithOptions(schema, dsn, opts)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = f.Close() })
+
+	if f.tx.stmt.Dialect() != statements.SQLite {
+		for gvk := range schema.AllKnownTypes() {
+			if strings.HasSuffix(gvk.Kind, "List") {
+				continue
+			}
+			dropTestTable(t, f, opts.TablePrefix+strings.ToLower(gvk.Kind))
+		}
+		// The shared tables don't exist yet on a new database.
+		_, _ = f.SQLDB.Exec("DELETE FROM quota_usage")
+	}
+	return f
+}
+
+// dropTestTable drops the table name of a Factory of newTestFactory, and its rows in the shared tables.
+func dropTestTable(t *testing.T, f *Factory, name string) {
+	t.Helper()
+
+	dropTable(t, f.SQLDB, name, f.tx.stmt.Dialect())
+	for _, table := range []string{"compaction", "cursors", "leases"} {
+		_, _ = f.SQLDB.Exec("DELETE FROM " + table + " WHERE name = '" + name + "'")
+	}
 }
 
 func TestMigrate(t *testing.T) {
 	_ = newDatabase(t)
 }
 
+func TestMigrateLatest(t *testing.T) {
+	s := newDatabase(t)
+	if s.stmt.Dialect() == statements.MySQL {
+		t.Skip("MySQL tables are always created with the latest column")
+	}
+
+	// Recreate the table as it was before the latest column existed.
+	for _, stmt := range []string{
+		"DROP INDEX IF EXISTS recordstest_unique_name_namespace_latest",
+		"DROP INDEX IF EXISTS recordstest_latest_id",
+		"ALTER TABLE recordstest DROP COLUMN latest",
+	} {
+		_, err := s.sqlDB.Exec(stmt)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, s.migrate(context.Background(), []string{"field.selector"}, nil))
+
+	rec, err := s.get(context.Background(), "default", "test")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), rec.id)
+
+	_, records, err := s.list(context.Background(), nil, nil, 0, false, 0, 0, nil)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, int64(3), records[0].id)
+
+	// Older revisions are still read from the history
+	_, records, err = s.list(context.Background(), nil, nil, 2, false, 0, 0, nil)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "value2", records[0].value)
+}
+
 func insertRows(t *testing.T, s *db) {
 	t.Helper()
 
@@ -273,6 +384,31 @@ func TestListAfter(t *testing.T) {
 	assert.Equal(t, int64(1), meta.CompactionID)
 }
 
+func TestListAfterBounded(t *testing.T) {
+	s := newDatabase(t)
+
+	meta, records, err := s.list(context.Background(), ptr("default"), nil, 1, true, 2, 0, nil)
+	require.NoError(t, err)
+	assert.Len(t, records, 1)
+
+	assert.Equal(t, "value2", records[0].value)
+
+	assert.Equal(t, int64(2), meta.ListID)
+	assert.Equal(t, int64(1), meta.CompactionID)
+
+	meta, records, err = s.list(context.Background(), ptr("default"), nil, 1, true, 0, 1, nil)
+	require.NoError(t, err)
+	assert.Len(t, records, 2)
+
+	assert.Equal(t, int64(3), meta.ListID)
+
+	meta, records, err = s.list(context.Background(), ptr("default"), nil, 3, true, 3, 1, nil)
+	require.NoError(t, err)
+	assert.Len(t, records, 0)
+
+	assert.Equal(t, int64(3), meta.ListID)
+}
+
 func TestDelete(t *testing.T) {
 	s := newDatabase(t)
 
@@ -611,3 +747,383 @@ func TestUIDMatch(t *testing.T) {
 	_, ok := err.(*storage.StorageError)
 	assert.True(t, ok)
 }
+
+type sqlStateError string
+
+func (e sqlStateError) Error() string {
+	return "sql error " + string(e)
+}
+
+func (e sqlStateError) SQLState() string {
+	return string(e)
+}
+
+type sqlCodeError int
+
+func (e sqlCodeError) Error() string {
+	return fmt.Sprintf("sql error %d", int(e))
+}
+
+func (e sqlCodeError) Code() int {
+	return int(e)
+}
+
+// contentionErrors returns the errors the dialect of s fails with on a serialization failure, a statement timeout
+// and a lock timeout. The timeouts are nil if the dialect doesn't have them.
+func contentionErrors(s *db) (retryable, timeout, lockTimeout error) {
+	switch s.stmt.Dialect() {
+	case statements.Postgres:
+		return retryable, sqlStateError("57014"), sqlStateError("55P03")
+	case statements.MySQL:
+		return &mysql.MySQLError{Number: 1213}, &mysql.MySQLError{Number: 3024}, &mysql.MySQLError{Number: 1205}
+	}
+	// SQLITE_BUSY
+	return sqlCodeError(5), nil, nil
+}
+
+func TestRetry(t *testing.T) {
+	s := newDatabase(t)
+	retryable, _, _ := contentionErrors(s)
+
+	var attempts int
+	err := s.inTx(context.Background(), nil, func(ctx context.Context) error {
+		attempts++
+		if attempts < 3 {
+			return retryable
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+
+	attempts = 0
+	err = s.inTx(context.Background(), nil, func(ctx context.Context) error {
+		attempts++
+		return retryable
+	})
+	assert.True(t, apierrors.IsTooManyRequests(err))
+	assert.Equal(t, txAttempts, attempts)
+
+	// Other errors are not retried
+	attempts = 0
+	err = s.inTx(context.Background(), nil, func(ctx context.Context) error {
+		attempts++
+		return apierrors.NewNotFound(testGVK.GroupVersion().WithResource("testkinds").GroupResource(), "test")
+	})
+	assert.True(t, apierrors.IsNotFound(err))
+	assert.Equal(t, 1, attempts)
+}
+
+func TestTimeout(t *testing.T) {
+	s := newDatabase(t)
+
+	s.timeouts.Get = time.Nanosecond
+	_, err := s.get(context.Background(), "default", "test")
+	assert.True(t, apierrors.IsTimeout(err))
+
+	s.timeouts.Get = 0
+	_, err = s.get(context.Background(), "default", "test")
+	require.NoError(t, err)
+
+	_, timeout, lockTimeout := contentionErrors(s)
+	if timeout == nil {
+		return
+	}
+
+	err = s.inTx(context.Background(), nil, func(ctx context.Context) error {
+		return timeout
+	})
+	assert.True(t, apierrors.IsTimeout(err))
+
+	err = s.inTx(context.Background(), nil, func(ctx context.Context) error {
+		return lockTimeout
+	})
+	assert.True(t, apierrors.IsTooManyRequests(err))
+}
+
+func TestConcurrentWriters(t *testing.T) {
+	s := newDatabase(t)
+
+	const writers, writes = 8, 10
+	var (
+		wg        sync.WaitGroup
+		committed = make(chan int64, writers*writes)
+	)
+	for w := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range writes {
+				id, err := s.insert(context.Background(), record{
+					name:      fmt.Sprintf("writer%d-%d", w, i),
+					namespace: "default",
+					created:   1,
+					vals:      []any{"selector"},
+					value:     "value",
+				})
+				if !assert.NoError(t, err) {
+					return
+				}
+				committed <- id
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	// A reader following the change log must see every write, so ids must never be committed below the ids it
+	// already read.
+	var (
+		cursor int64 = 3
+		seen         = map[int64]bool{}
+	)
+	for finished := false; !finished || len(seen) < writers*writes; {
+		select {
+		case <-done:
+			finished = true
+		default:
+		}
+		_, records, err := s.list(context.Background(), nil, nil, cursor, true, 0, 0, nil)
+		require.NoError(t, err)
+		for _, rec := range records {
+			require.Greater(t, rec.id, cursor)
+			cursor = rec.id
+			seen[rec.id] = true
+		}
+		if finished && len(seen) < writers*writes {
+			_, records, err = s.list(context.Background(), nil, nil, cursor, true, 0, 0, nil)
+			require.NoError(t, err)
+			require.NotEmpty(t, records, "writes were committed below the cursor")
+		}
+	}
+
+	close(committed)
+	for id := range committed {
+		assert.True(t, seen[id], "id %d was not read", id)
+	}
+	if s.stmt.Dialect() != statements.Postgres {
+		// Ids allocated from the table are gap-free, those of the Postgres sequence are only ordered.
+		assert.Equal(t, int64(3+writers*writes), cursor)
+	}
+}
+
+func TestSessionTimeout(t *testing.T) {
+	s := newDatabase(t)
+	if s.stmt.SessionTimeoutSQL().SQL == "" {
+		t.Skip("the timeout is local to the transaction")
+	}
+	// The setting must be read back from the connection the transaction ran on.
+	s.sqlDB.SetMaxOpenConns(1)
+
+	sessionTimeout := func(ctx context.Context) (value int64) {
+		t.Helper()
+		require.NoError(t, s.queryRowContext(ctx, s.stmt.SessionTimeoutSQL()).Scan(&value))
+		return value
+	}
+	before := sessionTimeout(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	require.NoError(t, s.inTx(ctx, nil, func(ctx context.Context) error {
+		assert.NotEqual(t, before, sessionTimeout(ctx))
+		return nil
+	}))
+	assert.Equal(t, before, sessionTimeout(context.Background()))
+
+	// Transactions without a deadline keep the setting of the connection
+	require.NoError(t, s.inTx(context.Background(), nil, func(ctx context.Context) error {
+		assert.Equal(t, before, sessionTimeout(ctx))
+		return nil
+	}))
+}
+
+func TestStatementLogging(t *testing.T) {
+	s := newDatabase(t)
+
+	logger, hook := logrustest.NewNullLogger()
+	s.logger = glogrus.New(glogrus.Config{
+		Logger:        logger,
+		SlowThreshold: time.Nanosecond,
+	})
+
+	_, err := s.get(context.Background(), "default", "test")
+	require.NoError(t, err)
+
+	var statements []string
+	for _, entry := range hook.AllEntries() {
+		assert.NotContains(t, entry.Data, "sql")
+		statements = append(statements, entry.Data["statement"].(string))
+	}
+	assert.Contains(t, statements, "listlatest.sql")
+
+	entry := hook.AllEntries()[len(hook.AllEntries())-1]
+	assert.Equal(t, "sql query slow", entry.Message)
+
+	// Errors that are handled, like schema conflicts during migrations and unique violations, are not logged as
+	// errors.
+	hook.Reset()
+	require.NoError(t, s.migrate(context.Background(), []string{"field.selector"}, nil))
+	_, err = s.insert(context.Background(), record{
+		name:      "test",
+		namespace: "default",
+		created:   1,
+		vals:      []any{"selector"},
+		value:     "value",
+	})
+	assert.True(t, apierrors.IsAlreadyExists(err))
+	for _, entry := range hook.AllEntries() {
+		assert.NotEqual(t, logrus.ErrorLevel, entry.Level, entry.Data["statement"])
+	}
+}
+
+type unknownDriver struct{}
+
+func (unknownDriver) Open(string) (driver.Conn, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func TestDialectOf(t *testing.T) {
+	sqldb, dialect := newSQLDB(t)
+	detected, err := dialectOf(sqldb)
+	require.NoError(t, err)
+	if dialect != statements.CockroachDB {
+		assert.Equal(t, dialect, detected)
+	}
+
+	// The dialect of unknown drivers is not guessed
+	_, err = dialectOf(sql.OpenDB(driverConnector{unknownDriver{}}))
+	assert.Error(t, err)
+}
+
+// driverConnector opens connections with a driver that is not registered.
+type driverConnector struct {
+	driver driver.Driver
+}
+
+func (c driverConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open("")
+}
+
+func (c driverConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+func TestMySQLStatements(t *testing.T) {
+	stmt := statements.New(statements.MySQL, "recordstest", []string{"field.selector"})
+
+	list := stmt.ListSQL(0)
+	assert.NotContains(t, list.SQL, "$")
+	assert.Contains(t, list.SQL, "FROM `recordstest`")
+	// Parameters used more than once are bound to the same argument every time.
+	assert.Equal(t, []any{"ns", "ns", "name", "name", 1, 1, 2, 2, "field", "field"},
+		list.Args("ns", "name", 1, 2, "field"))
+
+	assert.Equal(t, "writelock.sql", stmt.WriteLockSQL().Name)
+	assert.Empty(t, stmt.SequenceSQL().SQL)
+	assert.True(t, stmt.Dialect().LastInsertID())
+}
+
+func TestCockroachDBStatements(t *testing.T) {
+	stmt := statements.New(statements.CockroachDB, "recordstest", nil)
+
+	// Writers are not locked, ids are allocated from the table and conflicting transactions are retried.
+	assert.Empty(t, stmt.WriteLockSQL().SQL)
+	assert.Empty(t, stmt.SequenceSQL().SQL)
+	assert.Contains(t, stmt.InsertSQL().SQL, "MAX(id)")
+	assert.Equal(t, sql.LevelSerializable, stmt.Dialect().Isolation(sql.LevelRepeatableRead))
+	assert.True(t, stmt.Dialect().IsRetryable(sqlStateError("40001")))
+}
+
+func TestLease(t *testing.T) {
+	s := newDatabase(t)
+	_, err := s.sqlDB.Exec("DELETE FROM leases WHERE name = 'leasetest'")
+	require.NoError(t, err)
+
+	first := newLease(s, "leasetest", time.Hour)
+	second := newLease(s, "leasetest", time.Hour)
+
+	held, err := first.acquire(ctx)
+	require.NoError(t, err)
+	assert.True(t, held)
+	held, err = second.acquire(ctx)
+	require.NoError(t, err)
+	assert.False(t, held)
+
+	// The holder renews the lease
+	held, err = first.acquire(ctx)
+	require.NoError(t, err)
+	assert.True(t, held)
+
+	// Only the holder releases the lease
+	require.NoError(t, second.release(ctx))
+	held, err = second.acquire(ctx)
+	require.NoError(t, err)
+	assert.False(t, held)
+	require.NoError(t, first.release(ctx))
+	held, err = second.acquire(ctx)
+	require.NoError(t, err)
+	assert.True(t, held)
+
+	// An expired lease is taken over
+	_, err = s.sqlDB.Exec("UPDATE leases SET expires_at = 0 WHERE name = 'leasetest'")
+	require.NoError(t, err)
+	held, err = first.acquire(ctx)
+	require.NoError(t, err)
+	assert.True(t, held)
+	held, err = second.acquire(ctx)
+	require.NoError(t, err)
+	assert.False(t, held)
+
+	// A lease that has not expired is not taken over, even with the expiry it already has. MySQL assigns the columns
+	// in order, so the holder must be compared against the expiry before it is updated.
+	_, err = s.sqlDB.Exec("UPDATE leases SET expires_at = 2000 WHERE name = 'leasetest'")
+	require.NoError(t, err)
+	_, err = s.execContext(ctx, s.stmt.AcquireLeaseSQL(), "leasetest", second.holder, int64(2000), int64(1000))
+	require.NoError(t, err)
+	var holder string
+	require.NoError(t, s.queryRowContext(ctx, s.stmt.LeaseHolderSQL(), "leasetest").Scan(&holder))
+	assert.Equal(t, first.holder, holder)
+}
+
+func TestWatermarkCache(t *testing.T) {
+	var (
+		c     watermarkCache
+		reads int
+	)
+	read := func() (int64, bool, error) {
+		reads++
+		return int64(reads), true, nil
+	}
+
+	value, ok, err := c.get(read)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), value)
+
+	// The watermark is reused until it is invalidated
+	value, _, err = c.get(read)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), value)
+
+	c.invalidate()
+	value, _, err = c.get(read)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), value)
+
+	// A write that commits during a read invalidates its result
+	c.invalidate()
+	value, _, err = c.get(func() (int64, bool, error) {
+		c.invalidate()
+		return read()
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), value)
+	value, _, err = c.get(read)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), value)
+
+	(*watermarkCache)(nil).invalidate()
+}
@@ -1,9 +1,11 @@
 package errors
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
+	"github.com/obot-platform/kinm/pkg/db/statements"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apiserver/pkg/storage"
@@ -53,3 +55,29 @@ func NewResourceVersionMismatch(gvk schema.GroupVersionKind, name string) error
 		Resource: gvk.Kind,
 	}, name, errors.New(OptimisticLockErrorMsg))
 }
+
+// NewQuotaExceeded returns the error of a write of the object name that would exceed the quota of its namespace.
+func NewQuotaExceeded(gvk schema.GroupVersionKind, name string, err error) error {
+	return apierrors.NewForbidden(schema.GroupResource{
+		Group:    gvk.Group,
+		Resource: gvk.Kind,
+	}, name, fmt.Errorf("exceeded quota: %w", err))
+}
+
+func NewTooManyRequests(err error) error {
+	return apierrors.NewTooManyRequests(fmt.Sprintf("too much contention, please try again: %v", err), 1)
+}
+
+// FromTimeout returns an API error for err if it was caused by a timeout or by contention with other transactions.
+// Otherwise, err is returned unchanged.
+func FromTimeout(dialect statements.Dialect, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, context.DeadlineExceeded), dialect.IsTimeout(err):
+		return apierrors.NewTimeoutError(fmt.Sprintf("database operation timed out: %v", err), 1)
+	case dialect.IsLockTimeout(err), dialect.IsRetryable(err):
+		return NewTooManyRequests(err)
+	}
+	return err
+}
@@ -0,0 +1,81 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/obot-platform/kinm/pkg/types"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// expireBatchSize is the number of expired objects deleted per query.
+const expireBatchSize = 100
+
+// objectExpiry returns the unix time after which obj is deleted, from types.Expirer or the
+// types.ExpiresAtAnnotation, or nil if it does not expire.
+func objectExpiry(obj types.Object) (*int64, error) {
+	if e, ok := obj.(types.Expirer); ok {
+		expiresAt := e.ExpiresAt()
+		if expiresAt == nil {
+			return nil, nil
+		}
+		unix := expiresAt.Unix()
+		return &unix, nil
+	}
+
+	value, ok := obj.GetAnnotations()[types.ExpiresAtAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	expiresAt, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("invalid %s annotation %q: %v", types.ExpiresAtAnnotation, value, err))
+	}
+	unix := expiresAt.Unix()
+	return &unix, nil
+}
+
+// expire deletes the objects that expired, and removes the objects whose grace period ended. They are deleted like
+// any other, so objects with finalizers are only marked for deletion and watches see the changes.
+func (s *Strategy) expire(ctx context.Context) (count int, _ error) {
+	for {
+		records, err := s.db.expired(ctx, time.Now(), expireBatchSize)
+		if err != nil {
+			return count, err
+		}
+
+		var deleted int
+		for _, rec := range records {
+			obj := s.New()
+			if err := rec.Unmarshal(obj); err != nil {
+				return count, err
+			}
+			if obj.GetDeletionTimestamp() != nil {
+				// The grace period of the object ended
+				obj.SetDeletionGracePeriodSeconds(new(int64))
+			}
+			if _, err := s.Delete(ctx, obj); apierrors.IsConflict(err) || apierrors.IsNotFound(err) {
+				// The object changed since it was read, it's read again with the next batch.
+				continue
+			} else if err != nil {
+				return count, err
+			}
+			deleted++
+		}
+		count += deleted
+
+		// A batch of objects that all changed since they were read is left to the next sweep, they would be read
+		// again right away.
+		if deleted == 0 || len(records) < expireBatchSize {
+			return count, nil
+		}
+	}
+}
+
+// inGracePeriod returns true if obj is being deleted gracefully, in which case it is kept until its deletion
+// timestamp, see types.GracefulDeleter.
+func inGracePeriod(obj types.Object) bool {
+	period := obj.GetDeletionGracePeriodSeconds()
+	return obj.GetDeletionTimestamp() != nil && period != nil && *period > 0
+}
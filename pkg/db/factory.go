@@ -3,67 +3,109 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
-	"os"
-	"strconv"
 	"strings"
-	"time"
+	"sync"
+	"sync/atomic"
 
+	gosqlite "github.com/glebarez/go-sqlite"
 	"github.com/glebarez/sqlite"
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/lib/pq"
 	"github.com/obot-platform/kinm/pkg/db/glogrus"
+	"github.com/obot-platform/kinm/pkg/db/statements"
+	kotel "github.com/obot-platform/kinm/pkg/otel"
 	"github.com/obot-platform/kinm/pkg/strategy"
 	"github.com/obot-platform/kinm/pkg/types"
-	"github.com/sirupsen/logrus"
+	"gorm.io/driver/mysql"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 )
 
-var (
-	maxConnections     = 5
-	maxIdleConnections = 2
-	maxConnLifetime    = 3 * time.Minute
-)
+type Factory struct {
+	DB    *gorm.DB
+	SQLDB *sql.DB
+	// ReadDB is a separate pool used for reads outside a transaction. It is nil if reads share SQLDB.
+	ReadDB  *sql.DB
+	schema  *runtime.Scheme
+	options FactoryOptions
+	// logger logs the statements of the strategies created by the Factory.
+	logger *glogrus.Logger
+	// tx runs the transactions of Transaction, it has no table of its own.
+	tx db
+	// quotas are the quotas of FactoryOptions.Quotas, nil if it is not set.
+	quotas *quotas
 
-func init() {
-	if x, err := strconv.Atoi(os.Getenv("KINM_DB_CONNECTIONS")); err == nil && x > 0 {
-		maxConnections = x
-		maxIdleConnections = x
-	}
-	if x, err := strconv.Atoi(os.Getenv("KINM_DB_MAX_IDLE_CONNECTIONS")); err == nil && x > 0 {
-		maxIdleConnections = x
-	}
-	if x, err := strconv.Atoi(os.Getenv("KINM_DB_MAX_CONNECTIONS")); err == nil && x > 0 {
-		maxConnections = x
-	}
-	if x, err := strconv.Atoi(os.Getenv("KINM_DB_MAX_CONNECTION_LIFETIME_SECONDS")); err == nil && x > 0 {
-		maxConnLifetime = time.Duration(x) * time.Second
-	}
-}
+	strategiesLock sync.Mutex
+	// strategies are the strategies created by the Factory, by their kind.
+	strategies map[schema.GroupVersionKind]*Strategy
+	// namespaces is the strategy of the built-in Namespace kind, if it was created.
+	namespaces *Strategy
+	// registered is closed when a strategy is created, it is nil until registrations is called.
+	registered chan struct{}
 
-type Factory struct {
-	DB               *gorm.DB
-	SQLDB            *sql.DB
-	schema           *runtime.Scheme
-	migrationTimeout time.Duration
+	// collectors is the number of calls to CollectGarbage that are running.
+	collectors atomic.Int32
 }
 
+// NewFactory returns a Factory with the default options.
 func NewFactory(schema *runtime.Scheme, dsn string) (*Factory, error) {
+	return NewFactoryWithOptions(schema, dsn, FactoryOptions{})
+}
+
+func NewFactoryWithOptions(schema *runtime.Scheme, dsn string, opts FactoryOptions) (*Factory, error) {
+	opts = opts.complete()
+	if opts.TraceLevel != "" {
+		kotel.SetLevel(opts.TraceLevel)
+	}
 	f := &Factory{
-		schema: schema,
+		schema:  schema,
+		options: opts,
+		logger: glogrus.New(glogrus.Config{
+			Logger:        opts.Logger,
+			SlowThreshold: opts.SlowThreshold,
+			LogSQL:        opts.LogSQL,
+		}),
+	}
+	if opts.Quotas != nil {
+		f.quotas = &quotas{
+			limits:  opts.Quotas,
+			factory: f,
+		}
 	}
 
 	var (
 		gdb                    gorm.Dialector
 		pool                   bool
 		skipDefaultTransaction bool
+		readDSN                string
 	)
 	switch {
 	case strings.HasPrefix(dsn, "sqlite://"):
 		skipDefaultTransaction = true
-		gdb = sqlite.Open(strings.TrimPrefix(dsn, "sqlite://"))
+		dsn = sqliteDSN(strings.TrimPrefix(dsn, "sqlite://"))
+		gdb = sqlite.Open(dsn)
+		if !sqliteInMemory(dsn) {
+			// In WAL mode readers don't block the writer, so lists and watches get their own pool instead of
+			// waiting on the single writer connection.
+			readDSN = dsn + "&_pragma=query_only(1)"
+		}
+	case strings.HasPrefix(dsn, "mysql://"):
+		gdb = mysql.Open(mysqlDSN(strings.TrimPrefix(dsn, "mysql://")))
+		pool = true
+	case strings.HasPrefix(dsn, "cockroachdb://"):
+		dsn = strings.Replace(dsn, "cockroachdb://", "postgres://", 1)
+		gdb = postgres.Open(dsn)
+		pool = true
+		if f.options.Strategy.Dialect == nil {
+			f.options.Strategy.Dialect = statements.CockroachDB
+		}
 	case strings.HasPrefix(dsn, "postgresql://"):
 		dsn = strings.Replace(dsn, "postgresql://", "postgres://", 1)
 		fallthrough
@@ -73,10 +115,11 @@ func NewFactory(schema *runtime.Scheme, dsn string) (*Factory, error) {
 	default:
 		return nil, fmt.Errorf("unsupported database: %s", dsn)
 	}
-	db, err := gorm.Open(gdb, &gorm.Config{
+	gormDB, err := gorm.Open(gdb, &gorm.Config{
 		SkipDefaultTransaction: skipDefaultTransaction,
 		Logger: glogrus.New(glogrus.Config{
-			SlowThreshold:             200 * time.Millisecond,
+			Logger:                    opts.Logger,
+			SlowThreshold:             opts.SlowThreshold,
 			IgnoreRecordNotFoundError: true,
 			LogSQL:                    true,
 		}),
@@ -85,23 +128,106 @@ func NewFactory(schema *runtime.Scheme, dsn string) (*Factory, error) {
 		return nil, err
 	}
 
-	sqlDB, err := db.DB()
+	sqlDB, err := gormDB.DB()
 	if err != nil {
 		return nil, err
 	}
-	sqlDB.SetConnMaxLifetime(maxConnLifetime)
+	sqlDB.SetConnMaxLifetime(opts.MaxConnectionLifetime)
 	if pool {
-		sqlDB.SetMaxIdleConns(maxIdleConnections)
-		sqlDB.SetMaxOpenConns(maxConnections)
+		sqlDB.SetMaxIdleConns(opts.MaxIdleConnections)
+		sqlDB.SetMaxOpenConns(opts.MaxConnections)
 	} else {
 		sqlDB.SetMaxIdleConns(1)
 		sqlDB.SetMaxOpenConns(1)
 	}
-	f.DB = db
+	f.DB = gormDB
 	f.SQLDB = sqlDB
+
+	if readDSN != "" {
+		readDB, err := sql.Open("sqlite", readDSN)
+		if err != nil {
+			return nil, err
+		}
+		readDB.SetConnMaxLifetime(opts.MaxConnectionLifetime)
+		readDB.SetMaxIdleConns(opts.MaxIdleConnections)
+		readDB.SetMaxOpenConns(opts.MaxConnections)
+		f.ReadDB = readDB
+	}
+
+	dialect := f.options.Strategy.Dialect
+	if dialect == nil {
+		if dialect, err = dialectOf(sqlDB); err != nil {
+			return nil, err
+		}
+	}
+	f.tx = db{
+		sqlDB:  sqlDB,
+		stmt:   statements.New(dialect, "", nil),
+		logger: f.logger,
+	}
 	return f, nil
 }
 
+// dialectOf returns the dialect of the database opened by sqlDB. The dialect of other drivers must be set with
+// StrategyOptions.Dialect.
+func dialectOf(sqlDB *sql.DB) (statements.Dialect, error) {
+	switch driver := sqlDB.Driver().(type) {
+	case *stdlib.Driver, *pq.Driver:
+		return statements.Postgres, nil
+	case *mysqldriver.MySQLDriver:
+		return statements.MySQL, nil
+	case *gosqlite.Driver:
+		return statements.SQLite, nil
+	default:
+		return nil, fmt.Errorf("unknown database driver %T, the dialect must be set", driver)
+	}
+}
+
+// sqliteDSN enables WAL mode and a busy timeout, unless the DSN already sets them.
+func sqliteDSN(dsn string) string {
+	if !strings.Contains(dsn, "?") {
+		dsn += "?"
+	} else {
+		dsn += "&"
+	}
+	var pragmas []string
+	if !strings.Contains(dsn, "journal_mode") {
+		pragmas = append(pragmas, "_pragma=journal_mode(WAL)")
+	}
+	if !strings.Contains(dsn, "busy_timeout") {
+		pragmas = append(pragmas, fmt.Sprintf("_pragma=busy_timeout(%d)", statements.DefaultBusyTimeout.Milliseconds()))
+	}
+	return strings.TrimSuffix(dsn+strings.Join(pragmas, "&"), "&")
+}
+
+// mysqlDSN enables multiple statements, which migrations need. The DSN is in the format of
+// github.com/go-sql-driver/mysql, for instance user:password@tcp(localhost:3306)/kinm.
+func mysqlDSN(dsn string) string {
+	if !strings.Contains(dsn, "?") {
+		dsn += "?"
+	} else {
+		dsn += "&"
+	}
+	if !strings.Contains(dsn, "multiStatements") {
+		dsn += "multiStatements=true"
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(dsn, "?"), "&")
+}
+
+func sqliteInMemory(dsn string) bool {
+	name, _, _ := strings.Cut(dsn, "?")
+	return name == "" || name == ":memory:" || strings.Contains(dsn, "mode=memory")
+}
+
+// Close closes the database pools of the Factory, which its strategies share. The strategies must not be used after.
+func (f *Factory) Close() error {
+	err := f.SQLDB.Close()
+	if f.ReadDB != nil {
+		err = errors.Join(err, f.ReadDB.Close())
+	}
+	return err
+}
+
 func (f *Factory) Scheme() *runtime.Scheme {
 	return f.schema
 }
@@ -113,33 +239,105 @@ func (f *Factory) Name() string {
 func (f *Factory) Check(req *http.Request) error {
 	err := f.SQLDB.PingContext(req.Context())
 	if err != nil {
-		logrus.Warnf("Failed to ping database: %v", err)
+		f.options.Logger.Warnf("Failed to ping database: %v", err)
+	} else if f.ReadDB != nil {
+		if err = f.ReadDB.PingContext(req.Context()); err != nil {
+			f.options.Logger.Warnf("Failed to ping read database: %v", err)
+		}
 	}
 
 	return err
 }
 
+// Transaction runs fn in a database transaction. The operations of the strategies created by the Factory that are
+// called with the context passed to fn are part of the transaction: they are all committed if fn returns nil, and
+// all rolled back otherwise. If an operation fails, fn must return its error. Watches are notified of the changes
+// once the transaction commits.
+//
+// If the transaction fails because of contention with another transaction, fn is called again in a new
+// transaction, so it must not have side effects outside of it. The operations must not be called concurrently.
+func (f *Factory) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	ctx, span := kotel.StartSpanIfParent(ctx, tracer, "dbFactoryTransaction")
+	defer span.End()
+
+	return f.tx.inTx(ctx, &sql.TxOptions{
+		Isolation: sql.LevelRepeatableRead,
+	}, fn)
+}
+
 type TableNamer interface {
 	TableName() string
 }
 
+// NewDBStrategy returns a strategy for the kind of obj with the default options of the Factory.
 func (f *Factory) NewDBStrategy(obj types.Object) (strategy.CompleteStrategy, error) {
+	return f.NewDBStrategyWithOptions(obj, StrategyOptions{})
+}
+
+// NewDBStrategyWithOptions returns a strategy for the kind of obj. Zero values in opts are replaced by the
+// defaults of the Factory. The Factory has one strategy per kind: it returns an error if the kind already has one
+// that was not destroyed.
+func (f *Factory) NewDBStrategyWithOptions(obj types.Object, opts StrategyOptions) (strategy.CompleteStrategy, error) {
 	gvk, err := apiutil.GVKForObject(obj, f.schema)
 	if err != nil {
 		return nil, err
 	}
 
+	f.strategiesLock.Lock()
+	defer f.strategiesLock.Unlock()
+	if _, ok := f.strategies[gvk]; ok {
+		return nil, fmt.Errorf("a strategy already exists for %s", gvk)
+	}
+
 	tableName := strings.ToLower(gvk.Kind)
 	if tn, ok := obj.(TableNamer); ok {
 		tableName = tn.TableName()
 	}
 
-	ctx := context.Background()
-	if f.migrationTimeout != 0 {
-		// If configured, set a timeout for the migration
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, f.migrationTimeout)
-		defer cancel()
+	opts = opts.merge(f.options.Strategy)
+	opts.readDB = f.ReadDB
+	opts.logger = f.logger
+	opts.factory = f
+	opts.quotas = f.quotas
+	s, err := NewWithOptions(context.Background(), f.SQLDB, gvk, f.schema, f.options.TablePrefix+tableName, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.strategies == nil {
+		f.strategies = map[schema.GroupVersionKind]*Strategy{}
+	}
+	f.strategies[gvk] = s
+	if f.registered != nil {
+		close(f.registered)
+		f.registered = nil
+	}
+	return s, nil
+}
+
+// registrations returns a channel that is closed once a strategy is created.
+func (f *Factory) registrations() <-chan struct{} {
+	f.strategiesLock.Lock()
+	defer f.strategiesLock.Unlock()
+	if f.registered == nil {
+		f.registered = make(chan struct{})
+	}
+	return f.registered
+}
+
+// GarbageCollected returns true if the garbage collector of the Factory runs, see CollectGarbage.
+func (f *Factory) GarbageCollected() bool {
+	return f.collectors.Load() > 0
+}
+
+// unregister removes s from the strategies of the Factory, once it is destroyed.
+func (f *Factory) unregister(s *Strategy) {
+	f.strategiesLock.Lock()
+	defer f.strategiesLock.Unlock()
+	if f.strategies[s.db.gvk] == s {
+		delete(f.strategies, s.db.gvk)
+	}
+	if f.namespaces == s {
+		f.namespaces = nil
 	}
-	return New(ctx, f.SQLDB, gvk, f.schema, tableName)
 }
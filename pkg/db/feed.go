@@ -0,0 +1,250 @@
+package db
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/obot-platform/kinm/pkg/db/cdc"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// FeedOptions selects the changes in the feed of a Factory.
+type FeedOptions struct {
+	// Kinds limits the feed to these kinds, each one in the apiVersion/kind format, for instance apps/v1/Deployment
+	// or v1/ConfigMap. If empty, the changes of every kind are included.
+	Kinds []string
+	// Namespace limits the feed to the objects in the namespace. If empty, the objects of every namespace are
+	// included.
+	Namespace string
+	// ResumeToken is the token of the last event received from a previous feed, the feed resumes after it. Kinds
+	// that are not in the token start at their current head, so every kind does if it is empty.
+	ResumeToken string
+}
+
+// FeedEvent is a change in the feed of a Factory.
+type FeedEvent struct {
+	cdc.Event
+	// ResumeToken resumes a feed after this event. It holds the position of the feed in the change log of every
+	// kind.
+	ResumeToken string `json:"resumeToken"`
+}
+
+// feedKey identifies a kind in a resume token.
+func feedKey(gvk schema.GroupVersionKind) string {
+	return gvk.GroupVersion().String() + "/" + gvk.Kind
+}
+
+func encodeResumeToken(cursors map[string]int64) string {
+	data, _ := json.Marshal(cursors)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeResumeToken(token string) (map[string]int64, error) {
+	cursors := map[string]int64{}
+	if token == "" {
+		return cursors, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid resume token %q: %w", token, err)
+	}
+	if err := json.Unmarshal(data, &cursors); err != nil {
+		return nil, fmt.Errorf("invalid resume token %q: %w", token, err)
+	}
+	return cursors, nil
+}
+
+// Feed returns the changes of every kind that has a strategy created by the Factory, until ctx is done. Each kind
+// has its own change log, so there is no order between the changes of different kinds: they are interleaved as
+// they are read. The changes of a kind are in order.
+//
+// If the changes after the position of a kind were compacted, because the resume token is too old, the feed ends
+// with an Error event whose object is a ResourceExpired metav1.Status. The client must list the objects again and
+// start a new feed without the token.
+func (f *Factory) Feed(ctx context.Context, opts FeedOptions) (<-chan FeedEvent, error) {
+	cursors, err := decodeResumeToken(opts.ResumeToken)
+	if err != nil {
+		return nil, apierrors.NewBadRequest(err.Error())
+	}
+
+	var namespace *string
+	if opts.Namespace != "" {
+		namespace = &opts.Namespace
+	}
+
+	strategies := f.feedStrategies(opts.Kinds)
+	for key, s := range strategies {
+		if _, ok := cursors[key]; ok {
+			continue
+		}
+		meta, _, err := s.db.list(ctx, namespace, nil, 0, true, 0, 1, nil)
+		if err != nil {
+			return nil, err
+		}
+		cursors[key] = meta.ListID
+	}
+
+	type kindEvent struct {
+		key   string
+		event cdc.Event
+	}
+	events := make(chan kindEvent)
+	for key, s := range strategies {
+		go s.streamChanges(ctx, namespace, cursors[key], func(event cdc.Event) bool {
+			select {
+			case events <- kindEvent{key: key, event: event}:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+	}
+
+	result := make(chan FeedEvent)
+	go func() {
+		defer close(result)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case e := <-events:
+				if e.event.Type == watch.Error {
+					select {
+					case result <- FeedEvent{Event: e.event}:
+					case <-ctx.Done():
+					}
+					return
+				}
+				cursors[e.key] = e.event.ID
+				select {
+				case result <- FeedEvent{Event: e.event, ResumeToken: encodeResumeToken(cursors)}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return result, nil
+}
+
+// feedStrategies returns the strategies of the kinds, by their key in a resume token, or of every kind if kinds is
+// empty.
+func (f *Factory) feedStrategies(kinds []string) map[string]*Strategy {
+	f.strategiesLock.Lock()
+	defer f.strategiesLock.Unlock()
+
+	result := make(map[string]*Strategy, len(f.strategies))
+	for gvk, s := range f.strategies {
+		if key := feedKey(gvk); len(kinds) == 0 || slices.Contains(kinds, key) {
+			result[key] = s
+		}
+	}
+	return result
+}
+
+// streamChanges passes the changes after cursor, of the objects in namespace if set, to send until it returns false
+// or ctx is done. If the changes after cursor were compacted, it passes an Error event and returns.
+func (s *Strategy) streamChanges(ctx context.Context, namespace *string, cursor int64, send func(cdc.Event) bool) {
+	backoff := consumeBackoff
+	for {
+		changed := s.waitChange()
+
+		events, err := s.changesAfter(ctx, namespace, cursor)
+		if ctx.Err() != nil {
+			return
+		}
+		if apierrors.IsResourceExpired(err) {
+			status := err.(apierrors.APIStatus).Status()
+			send(cdc.Event{
+				Type:       watch.Error,
+				APIVersion: s.db.gvk.GroupVersion().String(),
+				Kind:       s.db.gvk.Kind,
+				Object:     &status,
+			})
+			return
+		}
+		if err != nil {
+			s.db.logger.Error(ctx, "failed to read the changes of %q for the feed: %v", s.db.gvk.Kind, err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, maxConsumeBackoff)
+			continue
+		}
+		backoff = consumeBackoff
+
+		for _, event := range events {
+			if !send(event) {
+				return
+			}
+			cursor = event.ID
+		}
+		if len(events) == watchBatchSize {
+			// There may be more changes already
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+// FeedHandler serves the feed of the Factory as NDJSON, one FeedEvent per line, until the client disconnects or the
+// feed ends. The FeedOptions are read from the kind, which can be repeated, namespace and resumeToken query
+// parameters. The handler does not authorize requests, it must only be served to trusted clients.
+func (f *Factory) FeedHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+		events, err := f.Feed(req.Context(), FeedOptions{
+			Kinds:       query["kind"],
+			Namespace:   query.Get("namespace"),
+			ResumeToken: query.Get("resumeToken"),
+		})
+		if err != nil {
+			code := http.StatusInternalServerError
+			if status, ok := err.(apierrors.APIStatus); ok {
+				code = int(status.Status().Code)
+			}
+			http.Error(w, err.Error(), code)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+		flusher, _ := w.(http.Flusher)
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		enc := json.NewEncoder(w)
+		for event := range events {
+			if err := enc.Encode(event); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	})
+}
+
+// Kinds returns the kinds that have a strategy created by the Factory.
+func (f *Factory) Kinds() []schema.GroupVersionKind {
+	f.strategiesLock.Lock()
+	defer f.strategiesLock.Unlock()
+	return slices.Collect(maps.Keys(f.strategies))
+}
@@ -0,0 +1,570 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/obot-platform/kinm/pkg/db/cdc"
+	"github.com/obot-platform/kinm/pkg/strategy"
+	"github.com/obot-platform/kinm/pkg/types"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/apiserver/pkg/storage"
+)
+
+const (
+	// gcRetryInterval is the wait before objects that failed to be collected are tried again.
+	gcRetryInterval = 5 * time.Second
+	// gcListBatchSize is the number of objects read per query when the garbage collector starts.
+	gcListBatchSize = 500
+	// gcLeaseName is the name of the lease of the garbage collector that runs, the others wait for it.
+	gcLeaseName = "garbage-collector"
+	// gcLeaseDuration is how long the lease of the garbage collector is held without being renewed. It is renewed
+	// three times as often.
+	gcLeaseDuration = 30 * time.Second
+)
+
+// errKindsChanged stops the garbage collector when strategies are created, so it starts again with their kinds.
+var errKindsChanged = errors.New("the kinds of the garbage collector changed")
+
+// gcOwner is an owner reference of a node.
+type gcOwner struct {
+	uid ktypes.UID
+	// block is the BlockOwnerDeletion of the reference.
+	block bool
+}
+
+// gcNode is an object in the ownership graph of the garbage collector. Only the objects that have owners, or that
+// are being deleted with the Foreground or Orphan policy, are nodes: the others are not collected, and their
+// dependents are found by their uid.
+type gcNode struct {
+	gvk             schema.GroupVersionKind
+	namespace, name string
+	owners          []gcOwner
+}
+
+// garbageCollector tracks the owner references of the objects of a Factory, by uid.
+type garbageCollector struct {
+	factory *Factory
+	nodes   map[ktypes.UID]gcNode
+	// dependents are the uids of the objects that reference each owner.
+	dependents map[ktypes.UID]map[ktypes.UID]struct{}
+	// gvks are the kinds of the nodes by apiVersion and kind, so that the nodes of a kind share their strings.
+	gvks map[[2]string]schema.GroupVersionKind
+	// cursors are the ids of the changes of each kind observed so far, by apiVersion and kind.
+	cursors map[[2]string]int64
+	queue   []ktypes.UID
+	queued  map[ktypes.UID]struct{}
+	failed  map[ktypes.UID]struct{}
+	// waiting are the owners whose finalizer is removed once the changes of every kind are observed.
+	waiting map[ktypes.UID]struct{}
+}
+
+// CollectGarbage deletes the objects whose owners are deleted, following the owner references of the kinds that
+// have a strategy created by the Factory, until ctx is done. Owners of other kinds are assumed to exist. When
+// strategies are created after it starts, it lists the objects of every kind again to collect their kinds as well.
+//
+// Like the garbage collector of Kubernetes, it implements the propagation policies of deletes:
+//   - Background: dependents are deleted once their owner is removed.
+//   - Foreground: the owner has the foregroundDeletion finalizer, which is removed once the dependents that block
+//     the deletion of their owner are removed. Dependents are deleted in the foreground as well.
+//   - Orphan: the owner has the orphan finalizer, which is removed once the reference to the owner is removed from
+//     its dependents.
+//
+// A dependent with other owners that are not being deleted is not deleted, the references to the deleted owners
+// are removed from it instead. Only one garbage collector runs per database at a time: the others wait for its
+// lease, and take over if its process stops renewing it. The strategies of the Factory only accept the Foreground
+// and Orphan policies while CollectGarbage runs.
+func (f *Factory) CollectGarbage(ctx context.Context) error {
+	f.collectors.Add(1)
+	defer f.collectors.Add(-1)
+
+	l := newLease(&f.tx, gcLeaseName, gcLeaseDuration)
+	defer func() {
+		if err := l.release(context.WithoutCancel(ctx)); err != nil {
+			f.logger.Error(ctx, "failed to release the lease of the garbage collector: %v", err)
+		}
+	}()
+
+	renew := time.NewTicker(gcLeaseDuration / 3)
+	defer renew.Stop()
+	for {
+		held, err := l.acquire(ctx)
+		if ctx.Err() != nil {
+			return nil
+		} else if err != nil {
+			f.logger.Error(ctx, "failed to acquire the lease of the garbage collector: %v", err)
+		}
+
+		if held {
+			err := f.collectGarbage(ctx, l, renew.C)
+			switch {
+			case ctx.Err() != nil:
+				return nil
+			case errors.Is(err, errKindsChanged) || apierrors.IsResourceExpired(err):
+				// The objects are listed again, there is no change to wait for.
+				continue
+			case err != nil:
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-renew.C:
+		}
+	}
+}
+
+// collectGarbage collects the objects of the kinds of the strategies of the Factory, while l is held and renewed on
+// every tick of renew. It returns nil once the lease is lost or ctx is done.
+func (f *Factory) collectGarbage(ctx context.Context, l *lease, renew <-chan time.Time) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	registered := f.registrations()
+	events, err := f.Feed(ctx, FeedOptions{})
+	if err != nil {
+		return err
+	}
+
+	gc := &garbageCollector{
+		factory:    f,
+		nodes:      map[ktypes.UID]gcNode{},
+		dependents: map[ktypes.UID]map[ktypes.UID]struct{}{},
+		gvks:       map[[2]string]schema.GroupVersionKind{},
+		cursors:    map[[2]string]int64{},
+		queued:     map[ktypes.UID]struct{}{},
+		failed:     map[ktypes.UID]struct{}{},
+		waiting:    map[ktypes.UID]struct{}{},
+	}
+
+	// The feed starts before the objects are listed, so no change is missed. Changes the list already includes are
+	// observed again, which is harmless since objects are always read again before they are collected.
+	for _, s := range f.feedStrategies(nil) {
+		if err := gc.observeAll(ctx, s); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+	}
+
+	// renewed renews the lease, it returns false once it is lost.
+	renewed := func() bool {
+		held, err := l.acquire(ctx)
+		if err != nil && ctx.Err() == nil {
+			f.logger.Error(ctx, "failed to renew the lease of the garbage collector: %v", err)
+		}
+		return held
+	}
+
+	retry := time.NewTicker(gcRetryInterval)
+	defer retry.Stop()
+	for {
+		if len(gc.queue) == 0 {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-registered:
+				return errKindsChanged
+			case <-renew:
+				if !renewed() {
+					return nil
+				}
+			case event, ok := <-events:
+				if err := feedError(ctx, event, ok); err != nil {
+					return err
+				}
+				gc.observe(event.Event)
+			case <-retry.C:
+				gc.retryFailed()
+			}
+			continue
+		}
+
+		// Observe the pending changes first, so the graph is as current as possible.
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-registered:
+			return errKindsChanged
+		case <-renew:
+			if !renewed() {
+				return nil
+			}
+			continue
+		case event, ok := <-events:
+			if err := feedError(ctx, event, ok); err != nil {
+				return err
+			}
+			gc.observe(event.Event)
+			continue
+		case <-retry.C:
+			gc.retryFailed()
+		default:
+		}
+
+		uid := gc.queue[0]
+		gc.queue = gc.queue[1:]
+		delete(gc.queued, uid)
+		if err := gc.process(ctx, uid); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			f.logger.Error(ctx, "failed to collect the garbage of %q: %v", uid, err)
+			gc.failed[uid] = struct{}{}
+		}
+	}
+}
+
+// feedError returns the error the feed ended with, if event is its Error event or it was closed before ctx is done.
+func feedError(ctx context.Context, event FeedEvent, ok bool) error {
+	switch {
+	case !ok && ctx.Err() == nil:
+		return fmt.Errorf("the feed of the garbage collector ended")
+	case ok && event.Type == watch.Error:
+		return apierrors.FromObject(event.Object)
+	}
+	return nil
+}
+
+// observeAll adds the objects of the kind of s to the graph.
+func (gc *garbageCollector) observeAll(ctx context.Context, s *Strategy) error {
+	opts := storage.ListOptions{
+		Predicate: storage.SelectionPredicate{
+			Limit: gcListBatchSize,
+		},
+	}
+	for {
+		list, err := s.List(ctx, "", opts)
+		if err != nil {
+			return err
+		}
+		if opts.Predicate.Continue == "" {
+			// The list includes the changes up to its resource version.
+			cursor, err := strconv.ParseInt(list.GetResourceVersion(), 10, 64)
+			if err != nil {
+				return err
+			}
+			gc.advance(s.db.gvk.GroupVersion().String(), s.db.gvk.Kind, cursor)
+		}
+		if err := meta.EachListItem(list, func(obj runtime.Object) error {
+			gc.observe(cdc.Event{
+				Type:       watch.Added,
+				APIVersion: s.db.gvk.GroupVersion().String(),
+				Kind:       s.db.gvk.Kind,
+				Object:     obj,
+			})
+			return nil
+		}); err != nil {
+			return err
+		}
+		if list.GetContinue() == "" {
+			return nil
+		}
+		opts.Predicate.Continue = list.GetContinue()
+	}
+}
+
+// observe updates the graph with a change, and queues the objects that may have to be collected because of it.
+func (gc *garbageCollector) observe(event cdc.Event) {
+	obj, ok := event.Object.(types.Object)
+	if !ok {
+		return
+	}
+	gc.advance(event.APIVersion, event.Kind, event.ID)
+	// The owners waiting for the changes are checked again, they may be observed now.
+	for uid := range gc.waiting {
+		gc.enqueue(uid)
+	}
+	clear(gc.waiting)
+
+	uid := obj.GetUID()
+	old, existed := gc.nodes[uid]
+	for _, owner := range old.owners {
+		if dependents := gc.dependents[owner.uid]; dependents != nil {
+			delete(dependents, uid)
+			if len(dependents) == 0 {
+				delete(gc.dependents, owner.uid)
+			}
+		}
+	}
+
+	if event.Type == watch.Deleted {
+		delete(gc.nodes, uid)
+		// The dependents of the object lost an owner, and its owners may wait for it to be removed.
+		for dependent := range gc.dependents[uid] {
+			gc.enqueue(dependent)
+		}
+		for _, owner := range old.owners {
+			gc.enqueue(owner.uid)
+		}
+		return
+	}
+
+	var node gcNode
+	for _, ref := range obj.GetOwnerReferences() {
+		node.owners = append(node.owners, gcOwner{
+			uid:   ref.UID,
+			block: ref.BlockOwnerDeletion != nil && *ref.BlockOwnerDeletion,
+		})
+		if gc.dependents[ref.UID] == nil {
+			gc.dependents[ref.UID] = map[ktypes.UID]struct{}{}
+		}
+		gc.dependents[ref.UID][uid] = struct{}{}
+	}
+
+	if len(node.owners) > 0 || (obj.GetDeletionTimestamp() != nil && hasGCFinalizer(obj)) {
+		node.gvk = gc.gvk(event.APIVersion, event.Kind)
+		node.namespace = obj.GetNamespace()
+		node.name = obj.GetName()
+		gc.nodes[uid] = node
+		gc.enqueue(uid)
+	} else {
+		delete(gc.nodes, uid)
+	}
+	if existed && !slices.Equal(old.owners, node.owners) {
+		// Owners waiting for their dependents may no longer wait for this one.
+		for _, owner := range old.owners {
+			gc.enqueue(owner.uid)
+		}
+	}
+}
+
+// advance moves the cursor of a kind to id, if it is further.
+func (gc *garbageCollector) advance(apiVersion, kind string, id int64) {
+	key := [2]string{apiVersion, kind}
+	gc.cursors[key] = max(gc.cursors[key], id)
+}
+
+// caughtUp returns true if the changes of every kind committed so far are observed. The changes of different kinds
+// are not ordered, so the dependents of an owner may be observed after it, until then the owner must wait.
+func (gc *garbageCollector) caughtUp(ctx context.Context, owner ktypes.UID) (bool, error) {
+	for _, s := range gc.factory.feedStrategies(nil) {
+		cursor := gc.cursors[[2]string{s.db.gvk.GroupVersion().String(), s.db.gvk.Kind}]
+		_, records, err := s.db.list(ctx, nil, nil, cursor, true, 0, 1, nil)
+		if err != nil {
+			return false, err
+		}
+		if len(records) > 0 {
+			gc.waiting[owner] = struct{}{}
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// gvk returns the kind of apiVersion and kind, shared by the nodes of the kind.
+func (gc *garbageCollector) gvk(apiVersion, kind string) schema.GroupVersionKind {
+	key := [2]string{apiVersion, kind}
+	gvk, ok := gc.gvks[key]
+	if !ok {
+		gvk = schema.FromAPIVersionAndKind(apiVersion, kind)
+		gc.gvks[key] = gvk
+	}
+	return gvk
+}
+
+func (gc *garbageCollector) enqueue(uid ktypes.UID) {
+	if _, ok := gc.queued[uid]; ok {
+		return
+	}
+	gc.queued[uid] = struct{}{}
+	gc.queue = append(gc.queue, uid)
+}
+
+func (gc *garbageCollector) retryFailed() {
+	for uid := range gc.failed {
+		gc.enqueue(uid)
+	}
+	clear(gc.failed)
+}
+
+// process collects the object with uid, or handles the dependents of it, if it is being deleted with the
+// Foreground or Orphan policy.
+func (gc *garbageCollector) process(ctx context.Context, uid ktypes.UID) error {
+	node, ok := gc.nodes[uid]
+	if !ok {
+		return nil
+	}
+	s := gc.factory.strategyFor(node.gvk)
+	if s == nil {
+		return nil
+	}
+	obj, err := s.Get(ctx, node.namespace, node.name)
+	if apierrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if obj.GetUID() != uid {
+		return nil
+	}
+
+	if obj.GetDeletionTimestamp() != nil {
+		switch {
+		case slices.Contains(obj.GetFinalizers(), metav1.FinalizerOrphanDependents):
+			return gc.orphanDependents(ctx, s, obj)
+		case slices.Contains(obj.GetFinalizers(), metav1.FinalizerDeleteDependents):
+			return gc.deleteDependents(ctx, s, obj)
+		}
+		return nil
+	}
+
+	return gc.checkOwners(ctx, s, obj)
+}
+
+// checkOwners deletes obj if none of its owners exist or they are all being deleted in the foreground. Otherwise,
+// the references to the owners that are removed or being deleted in the foreground are removed from obj.
+func (gc *garbageCollector) checkOwners(ctx context.Context, s *Strategy, obj types.Object) error {
+	var solid, dangling, waiting []metav1.OwnerReference
+	for _, ref := range obj.GetOwnerReferences() {
+		owner, exists, err := gc.getOwner(ctx, obj.GetNamespace(), ref)
+		switch {
+		case err != nil:
+			return err
+		case !exists:
+			dangling = append(dangling, ref)
+		case owner != nil && owner.GetDeletionTimestamp() != nil && slices.Contains(owner.GetFinalizers(), metav1.FinalizerDeleteDependents):
+			waiting = append(waiting, ref)
+		default:
+			solid = append(solid, ref)
+		}
+	}
+
+	if len(dangling) == 0 && len(waiting) == 0 {
+		return nil
+	}
+
+	if len(solid) > 0 {
+		obj.SetOwnerReferences(solid)
+		_, err := s.updateMetadata(ctx, obj)
+		return ignoreGone(err)
+	}
+
+	if len(waiting) > 0 && len(gc.dependents[obj.GetUID()]) > 0 && !slices.Contains(obj.GetFinalizers(), metav1.FinalizerDeleteDependents) {
+		// The owner waits for obj, which waits for its own dependents.
+		obj.SetFinalizers(append(obj.GetFinalizers(), metav1.FinalizerDeleteDependents))
+	}
+	_, err := s.Delete(ctx, obj)
+	return ignoreGone(err)
+}
+
+// getOwner returns the owner of ref for a dependent in namespace, and whether it exists. Owners of kinds that are
+// not managed by the Factory can't be read, they are assumed to exist and nil is returned.
+func (gc *garbageCollector) getOwner(ctx context.Context, namespace string, ref metav1.OwnerReference) (types.Object, bool, error) {
+	s := gc.factory.strategyFor(schema.FromAPIVersionAndKind(ref.APIVersion, ref.Kind))
+	if s == nil {
+		return nil, true, nil
+	}
+	if !strategy.NewScoper(s).NamespaceScoped() {
+		namespace = ""
+	}
+	owner, err := s.Get(ctx, namespace, ref.Name)
+	if apierrors.IsNotFound(err) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	return owner, owner.GetUID() == ref.UID, nil
+}
+
+// orphanDependents removes the references to owner from its dependents, then the orphan finalizer from owner.
+func (gc *garbageCollector) orphanDependents(ctx context.Context, s *Strategy, owner types.Object) error {
+	if ok, err := gc.caughtUp(ctx, owner.GetUID()); err != nil || !ok {
+		return err
+	}
+
+	for uid := range gc.dependents[owner.GetUID()] {
+		node, ok := gc.nodes[uid]
+		if !ok {
+			continue
+		}
+		ds := gc.factory.strategyFor(node.gvk)
+		if ds == nil {
+			continue
+		}
+		dependent, err := ds.Get(ctx, node.namespace, node.name)
+		if apierrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		refs := slices.DeleteFunc(dependent.GetOwnerReferences(), func(ref metav1.OwnerReference) bool {
+			return ref.UID == owner.GetUID()
+		})
+		if len(refs) == len(dependent.GetOwnerReferences()) {
+			continue
+		}
+		dependent.SetOwnerReferences(refs)
+		if _, err := ds.updateMetadata(ctx, dependent); ignoreGone(err) != nil {
+			return err
+		}
+	}
+
+	return gc.removeFinalizer(ctx, s, owner, metav1.FinalizerOrphanDependents)
+}
+
+// deleteDependents queues the dependents of owner to be deleted, and removes the foregroundDeletion finalizer from
+// owner once none of them block its deletion.
+func (gc *garbageCollector) deleteDependents(ctx context.Context, s *Strategy, owner types.Object) error {
+	var blocked bool
+	for uid := range gc.dependents[owner.GetUID()] {
+		gc.enqueue(uid)
+		for _, ref := range gc.nodes[uid].owners {
+			if ref.uid == owner.GetUID() && ref.block {
+				blocked = true
+			}
+		}
+	}
+	if blocked {
+		return nil
+	}
+	if ok, err := gc.caughtUp(ctx, owner.GetUID()); err != nil || !ok {
+		return err
+	}
+
+	return gc.removeFinalizer(ctx, s, owner, metav1.FinalizerDeleteDependents)
+}
+
+// removeFinalizer removes finalizer from obj, which removes obj if it's the last one.
+func (gc *garbageCollector) removeFinalizer(ctx context.Context, s *Strategy, obj types.Object, finalizer string) error {
+	obj.SetFinalizers(slices.DeleteFunc(obj.GetFinalizers(), func(f string) bool {
+		return f == finalizer
+	}))
+	_, err := s.updateMetadata(ctx, obj)
+	return ignoreGone(err)
+}
+
+// strategyFor returns the strategy created by the Factory for gvk, or nil if there is none.
+func (f *Factory) strategyFor(gvk schema.GroupVersionKind) *Strategy {
+	f.strategiesLock.Lock()
+	defer f.strategiesLock.Unlock()
+	return f.strategies[gvk]
+}
+
+func hasGCFinalizer(obj types.Object) bool {
+	return slices.ContainsFunc(obj.GetFinalizers(), func(f string) bool {
+		return f == metav1.FinalizerOrphanDependents || f == metav1.FinalizerDeleteDependents
+	})
+}
+
+// ignoreGone ignores the error of a write to an object that was removed. A conflict is not ignored, the object
+// changed since it was read and is tried again.
+func ignoreGone(err error) error {
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
@@ -75,14 +75,29 @@ func (l *Logger) Error(ctx context.Context, s string, args ...any) {
 }
 
 func (l *Logger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	l.trace(ctx, begin, logrus.Fields{"caller": gutils.FileWithLineNum()}, fc, err, logrus.ErrorLevel)
+}
+
+// TraceStatement logs a statement like Trace. The statement is identified by name, the SQL is only logged if LogSQL
+// is set. If expected is true, err is handled by the caller, for instance a unique violation that is returned as a
+// conflict, and it is logged at debug level instead of error.
+func (l *Logger) TraceStatement(ctx context.Context, name string, begin time.Time, fc func() (string, int64), err error, expected bool) {
+	errorLevel := logrus.ErrorLevel
+	if expected {
+		errorLevel = logrus.DebugLevel
+	}
+	l.trace(ctx, begin, logrus.Fields{"statement": name}, fc, err, errorLevel)
+}
+
+// trace logs a statement, errors are logged at errorLevel.
+func (l *Logger) trace(ctx context.Context, begin time.Time, fields logrus.Fields, fc func() (string, int64), err error, errorLevel logrus.Level) {
 	l.complete()
 	elapsed := time.Since(begin)
 	sql, affected := fc()
 
-	log := l.logger.WithContext(ctx).WithFields(logrus.Fields{
+	log := l.logger.WithContext(ctx).WithFields(fields).WithFields(logrus.Fields{
 		"elapsed":  elapsed,
 		"affected": affected,
-		"caller":   gutils.FileWithLineNum(),
 	})
 
 	if l.logSQL {
@@ -91,7 +106,7 @@ func (l *Logger) Trace(ctx context.Context, begin time.Time, fc func() (string,
 	}
 
 	if err != nil && !(l.ignoreRecordNotFoundError && errors.Is(err, gorm.ErrRecordNotFound)) {
-		log.WithError(err).Error("sql query error")
+		log.WithError(err).Log(errorLevel, "sql query error")
 		return
 	}
 
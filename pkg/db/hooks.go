@@ -0,0 +1,86 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/obot-platform/kinm/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// PreCommitHook is called in the transaction of every write of a kind, once the object is written. The event is
+// Added, Modified or Deleted, with the written object. If the hook returns an error, the write is rolled back and
+// the error is returned to the caller. The strategies of the Factory called with ctx read and write in the
+// transaction, so the hook can check other objects or write derived ones consistently with the write.
+//
+// The transaction may be retried on contention with other transactions, so the hook must not have side effects
+// outside of it.
+type PreCommitHook interface {
+	PreCommit(ctx context.Context, event watch.Event) error
+}
+
+// PreCommitHookFunc is a function that implements PreCommitHook.
+type PreCommitHookFunc func(ctx context.Context, event watch.Event) error
+
+func (f PreCommitHookFunc) PreCommit(ctx context.Context, event watch.Event) error {
+	return f(ctx, event)
+}
+
+// PostCommitHook is called once the transaction of a write of a kind commits, before the write returns. If the
+// write is part of a Factory transaction, it is called once that transaction commits. It is not called if the
+// transaction rolls back.
+type PostCommitHook interface {
+	PostCommit(ctx context.Context, event watch.Event)
+}
+
+// PostCommitHookFunc is a function that implements PostCommitHook.
+type PostCommitHookFunc func(ctx context.Context, event watch.Event)
+
+func (f PostCommitHookFunc) PostCommit(ctx context.Context, event watch.Event) {
+	f(ctx, event)
+}
+
+// withHooks runs write in a transaction with the pre-commit hooks of the strategy, and registers the post-commit
+// hooks to run once the transaction commits. Without hooks, write runs as is. If write returns an empty event type,
+// nothing was written, and the hooks are not called.
+func (s *Strategy) withHooks(ctx context.Context, write func(ctx context.Context) (types.Object, watch.EventType, error)) (types.Object, error) {
+	if len(s.preCommitHooks) == 0 && len(s.postCommitHooks) == 0 {
+		obj, _, err := write(ctx)
+		return obj, err
+	}
+
+	ctx, cancel := withTimeout(ctx, s.db.timeouts.Insert)
+	defer cancel()
+
+	var obj types.Object
+	err := s.db.inTx(ctx, &sql.TxOptions{
+		Isolation: sql.LevelRepeatableRead,
+	}, func(ctx context.Context) error {
+		var (
+			eventType watch.EventType
+			err       error
+		)
+		obj, eventType, err = write(ctx)
+		if err != nil || eventType == "" {
+			return err
+		}
+
+		event := watch.Event{Type: eventType, Object: obj.DeepCopyObject()}
+		for _, hook := range s.preCommitHooks {
+			if err := hook.PreCommit(ctx, event); err != nil {
+				return err
+			}
+		}
+
+		if len(s.postCommitHooks) > 0 {
+			onCommit(ctx, func() {
+				ctx := withoutTx(ctx)
+				for _, hook := range s.postCommitHooks {
+					hook.PostCommit(ctx, event)
+				}
+			})
+		}
+		return nil
+	})
+	return obj, err
+}
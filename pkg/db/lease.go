@@ -0,0 +1,49 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/uuid"
+)
+
+// lease elects one of the processes sharing the database to run a background task, such as the compaction of a
+// table. The holder must acquire it again before it expires to keep it, otherwise another process takes it.
+type lease struct {
+	db       *db
+	name     string
+	holder   string
+	duration time.Duration
+}
+
+// newLease returns the lease with name, held for duration once it is acquired. Each lease has its own holder, so
+// two leases with the same name in a process are held by one of them at a time.
+func newLease(d *db, name string, duration time.Duration) *lease {
+	return &lease{
+		db:       d,
+		name:     name,
+		holder:   string(uuid.NewUUID()),
+		duration: duration,
+	}
+}
+
+// acquire takes the lease if it is free or expired, or renews it if it is already held by l. It returns true if l
+// holds the lease.
+func (l *lease) acquire(ctx context.Context) (bool, error) {
+	now := time.Now()
+	if _, err := l.db.execContext(ctx, l.db.stmt.AcquireLeaseSQL(), l.name, l.holder, now.Add(l.duration).UnixMilli(), now.UnixMilli()); err != nil {
+		return false, err
+	}
+
+	var holder string
+	if err := l.db.queryRowContext(ctx, l.db.stmt.LeaseHolderSQL(), l.name).Scan(&holder); err != nil {
+		return false, err
+	}
+	return holder == l.holder, nil
+}
+
+// release frees the lease if l holds it, so another process can take it without waiting for it to expire.
+func (l *lease) release(ctx context.Context) error {
+	_, err := l.db.execContext(ctx, l.db.stmt.ReleaseLeaseSQL(), l.name, l.holder)
+	return err
+}
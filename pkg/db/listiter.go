@@ -11,9 +11,13 @@ import (
 	"k8s.io/apiserver/pkg/storage"
 )
 
+// watchBatchSize is the number of change log records read per query when resuming a watch from a resourceVersion.
+const watchBatchSize = 500
+
 func newLister(ctx context.Context, db *db, namespace string, opts storage.ListOptions, after bool) (string, iter.Seq2[record, error], error) {
 	var (
 		rev, cont int64
+		limit     = opts.Predicate.Limit
 		err       error
 	)
 
@@ -39,7 +43,13 @@ func newLister(ctx context.Context, db *db, namespace string, opts storage.ListO
 		}
 	}
 
-	listMeta, records, err := db.list(ctx, getNamespace(namespace), getName(opts), rev, after, cont, opts.Predicate.Limit, opts.Predicate.Field)
+	if after && limit == 0 {
+		// Page through the change log so that resuming a watch after a long gap does not load every change into
+		// memory at once or hold a single read transaction open for all of them.
+		limit = watchBatchSize
+	}
+
+	listMeta, records, err := db.list(ctx, getNamespace(namespace), getName(opts), rev, after, cont, limit, opts.Predicate.Field)
 	if err != nil {
 		return "", nil, err
 	}
@@ -54,19 +64,24 @@ func newLister(ctx context.Context, db *db, namespace string, opts storage.ListO
 				}
 			}
 
-			if opts.Predicate.Limit == 0 {
+			if limit == 0 {
 				// no limits mean we would have fetched all records initially
 				return
 			}
 
-			if len(records) <= int(opts.Predicate.Limit) {
+			if len(records) <= int(limit) {
 				// When we fetch we always get one more record than the limit. So if we have more records than the limit
 				// we know there could be more records to fetch. So if it's <= limit we know there's no more records to fetch.
 				return
 			}
 
-			// Continue to paginate records
-			_, records, err = db.list(ctx, getNamespace(namespace), getName(opts), rev, false, records[len(records)-1].id, opts.Predicate.Limit, opts.Predicate.Field)
+			// Continue to paginate records. Change log pages are bounded by the ListID of the first page, the same
+			// way list pages are, so that the returned resourceVersion covers every record yielded.
+			if after {
+				_, records, err = db.list(ctx, getNamespace(namespace), getName(opts), records[len(records)-1].id, true, rev, limit, opts.Predicate.Field)
+			} else {
+				_, records, err = db.list(ctx, getNamespace(namespace), getName(opts), rev, false, records[len(records)-1].id, limit, opts.Predicate.Field)
+			}
 			if err != nil {
 				yield(record{}, err)
 				return
@@ -0,0 +1,222 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/obot-platform/kinm/pkg/strategy"
+	"github.com/obot-platform/kinm/pkg/types"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/storage"
+)
+
+// namespaceResyncInterval is how often the namespace controller checks the namespaces that are being deleted, in
+// addition to every change of a namespace.
+const namespaceResyncInterval = 5 * time.Second
+
+// namespaceStrategy is the strategy of the built-in Namespace kind.
+type namespaceStrategy struct {
+	*Strategy
+}
+
+// PrepareForCreate sets the finalizer that keeps a namespace until its contents are deleted.
+func (namespaceStrategy) PrepareForCreate(_ context.Context, obj runtime.Object) {
+	ns := obj.(*types.Namespace)
+	if !slices.Contains(ns.Finalizers, types.NamespaceFinalizer) {
+		ns.Finalizers = append(ns.Finalizers, types.NamespaceFinalizer)
+	}
+	ns.Status.Phase = types.NamespaceActive
+}
+
+// NewNamespaceStrategy returns the strategy of the built-in types.Namespace kind, which must be in the scheme of the
+// Factory. Once it is created, the strategies of the Factory reject the creates of objects in namespaces that don't
+// exist or are being deleted, see CheckNamespace. RunNamespaceController must run to delete the contents of deleted
+// namespaces, or they are never removed.
+func (f *Factory) NewNamespaceStrategy() (strategy.CompleteStrategy, error) {
+	s, err := f.NewDBStrategy(&types.Namespace{})
+	if err != nil {
+		return nil, err
+	}
+
+	f.strategiesLock.Lock()
+	defer f.strategiesLock.Unlock()
+	f.namespaces = s.(*Strategy)
+	return namespaceStrategy{Strategy: f.namespaces}, nil
+}
+
+func (f *Factory) namespaceStrategy() *Strategy {
+	f.strategiesLock.Lock()
+	defer f.strategiesLock.Unlock()
+	return f.namespaces
+}
+
+// CheckNamespace returns an error if objects can't be created in namespace, because it does not exist or is being
+// deleted. Any namespace is accepted if the Factory has no namespace strategy.
+func (f *Factory) CheckNamespace(ctx context.Context, namespace string) error {
+	namespaces := f.namespaceStrategy()
+	if namespaces == nil {
+		return nil
+	}
+
+	gr := schema.GroupResource{Group: namespaces.db.gvk.Group, Resource: "namespaces"}
+	ns, err := namespaces.Get(ctx, "", namespace)
+	if apierrors.IsNotFound(err) {
+		return apierrors.NewNotFound(gr, namespace)
+	} else if err != nil {
+		return err
+	}
+	if ns.GetDeletionTimestamp() != nil {
+		return apierrors.NewForbidden(gr, namespace, fmt.Errorf("unable to create new content in namespace %s because it is being terminated", namespace))
+	}
+	return nil
+}
+
+// lockNamespace checks namespace like CheckNamespace, in the transaction of ctx, and locks it until the transaction
+// ends. The namespace can't be marked for deletion, nor removed, until then: once it is, the namespace controller
+// sees the objects created in the transaction.
+func (f *Factory) lockNamespace(ctx context.Context, namespace string) error {
+	namespaces := f.namespaceStrategy()
+	if namespaces == nil {
+		return nil
+	}
+
+	gr := schema.GroupResource{Group: namespaces.db.gvk.Group, Resource: "namespaces"}
+	rec, err := namespaces.db.lockLatest(ctx, "", namespace)
+	if apierrors.IsNotFound(err) {
+		return apierrors.NewNotFound(gr, namespace)
+	} else if err != nil {
+		return err
+	}
+	ns := namespaces.New()
+	if err := rec.Unmarshal(ns); err != nil {
+		return err
+	}
+	if ns.GetDeletionTimestamp() != nil {
+		return apierrors.NewForbidden(gr, namespace, fmt.Errorf("unable to create new content in namespace %s because it is being terminated", namespace))
+	}
+	return nil
+}
+
+// CheckNamespace implements strategy.NamespaceChecker with the namespaces of the Factory that created the strategy.
+func (s *Strategy) CheckNamespace(ctx context.Context, namespace string) error {
+	if s.factory == nil {
+		return nil
+	}
+	return s.factory.CheckNamespace(ctx, namespace)
+}
+
+// RunNamespaceController deletes the contents of the namespaces that are being deleted, in every namespaced kind that
+// has a strategy created by the Factory, then removes the namespaces, until ctx is done. A namespace is removed once
+// all its objects are, so objects with finalizers or a grace period hold it back.
+func (f *Factory) RunNamespaceController(ctx context.Context) error {
+	namespaces := f.namespaceStrategy()
+	if namespaces == nil {
+		return fmt.Errorf("the Factory has no namespace strategy, see NewNamespaceStrategy")
+	}
+
+	for {
+		changed := namespaces.waitChange()
+		if err := f.finalizeNamespaces(ctx, namespaces); err != nil && ctx.Err() == nil {
+			f.logger.Error(ctx, "failed to delete the contents of deleted namespaces: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changed:
+		case <-time.After(namespaceResyncInterval):
+		}
+	}
+}
+
+// finalizeNamespaces deletes the contents of every namespace that is being deleted.
+func (f *Factory) finalizeNamespaces(ctx context.Context, namespaces *Strategy) error {
+	list, err := namespaces.List(ctx, "", storage.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	err = meta.EachListItem(list, func(obj runtime.Object) error {
+		ns := obj.(*types.Namespace)
+		if ns.DeletionTimestamp == nil || !slices.Contains(ns.Finalizers, types.NamespaceFinalizer) {
+			return nil
+		}
+		if err := f.finalizeNamespace(ctx, namespaces, ns); err != nil {
+			errs = append(errs, fmt.Errorf("namespace %s: %w", ns.Name, err))
+		}
+		return nil
+	})
+	return errors.Join(append(errs, err)...)
+}
+
+// finalizeNamespace marks ns as terminating and deletes its contents. Once they are all removed, the finalizer is
+// removed from ns, which removes it.
+func (f *Factory) finalizeNamespace(ctx context.Context, namespaces *Strategy, ns *types.Namespace) error {
+	if ns.Status.Phase != types.NamespaceTerminating {
+		ns.Status.Phase = types.NamespaceTerminating
+		updated, err := namespaces.updateMetadata(ctx, ns)
+		if err != nil {
+			return ignoreGone(err)
+		}
+		ns = updated.(*types.Namespace)
+	}
+
+	var remaining bool
+	for _, s := range f.namespacedStrategies() {
+		list, err := s.List(ctx, ns.Name, storage.ListOptions{})
+		if err != nil {
+			return err
+		}
+		if err := meta.EachListItem(list, func(obj runtime.Object) error {
+			o := obj.(types.Object)
+			if o.GetDeletionTimestamp() != nil {
+				// Already being deleted, held back by finalizers or a grace period
+				remaining = true
+				return nil
+			}
+			deleted, err := s.Delete(ctx, o)
+			if apierrors.IsNotFound(err) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if len(deleted.GetFinalizers()) > 0 || inGracePeriod(deleted) {
+				remaining = true
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	if remaining {
+		// The namespace is checked again once the remaining objects are removed
+		return nil
+	}
+
+	ns.Finalizers = slices.DeleteFunc(ns.Finalizers, func(f string) bool {
+		return f == types.NamespaceFinalizer
+	})
+	_, err := namespaces.updateMetadata(ctx, ns)
+	return ignoreGone(err)
+}
+
+// namespacedStrategies returns the strategies created by the Factory for namespaced kinds.
+func (f *Factory) namespacedStrategies() []*Strategy {
+	f.strategiesLock.Lock()
+	defer f.strategiesLock.Unlock()
+
+	var result []*Strategy
+	for _, s := range f.strategies {
+		if s != f.namespaces && strategy.NewScoper(s).NamespaceScoped() {
+			result = append(result, s)
+		}
+	}
+	return result
+}
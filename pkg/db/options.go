@@ -0,0 +1,199 @@
+package db
+
+import (
+	"database/sql"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/obot-platform/kinm/pkg/db/glogrus"
+	"github.com/obot-platform/kinm/pkg/db/statements"
+	kotel "github.com/obot-platform/kinm/pkg/otel"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultCompactionInterval     = 15 * time.Minute
+	defaultExpiryInterval         = time.Minute
+	defaultSlowThreshold          = 200 * time.Millisecond
+	defaultGenerateNameRetryLimit = 5
+)
+
+// FactoryOptions configures a Factory. Zero values are replaced with defaults, which can be set with the KINM_DB_*
+// environment variables.
+type FactoryOptions struct {
+	// MaxConnections is the maximum number of open connections to Postgres. SQLite always uses a single writer
+	// connection, this is the size of the read pool instead. Defaults to KINM_DB_MAX_CONNECTIONS or 5.
+	MaxConnections int
+	// MaxIdleConnections is the maximum number of idle connections. Defaults to KINM_DB_MAX_IDLE_CONNECTIONS or 2.
+	MaxIdleConnections int
+	// MaxConnectionLifetime is the maximum amount of time a connection may be reused. Defaults to
+	// KINM_DB_MAX_CONNECTION_LIFETIME_SECONDS or 3 minutes.
+	MaxConnectionLifetime time.Duration
+	// SlowThreshold is the duration after which a query is logged as slow. If zero, 200ms is used.
+	SlowThreshold time.Duration
+	// Logger is the logger used for database logs. If nil, logrus.StandardLogger() is used.
+	Logger *logrus.Logger
+	// LogSQL includes the SQL of each statement in the logs. By default, statements are only logged by name.
+	LogSQL bool
+	// TablePrefix is prepended to the table name of every strategy created by the Factory.
+	TablePrefix string
+	// TraceLevel is the level of the spans of kinm, see otel.SetLevel. It applies to the whole process. If empty,
+	// KINM_TRACE_LEVEL is used.
+	TraceLevel kotel.Level
+	// Strategy is the default options for every strategy created by the Factory.
+	Strategy StrategyOptions
+	// Quotas, if set, limits the objects and bytes of each namespace, across the strategies created by the Factory.
+	// The usage of a namespace is only tracked while it has limits, it is counted when they are set. Every process
+	// sharing the database must have the same quotas.
+	Quotas QuotaFunc
+}
+
+// StrategyOptions configures a Strategy. Zero values are replaced with defaults.
+type StrategyOptions struct {
+	// Timeouts for the operations of the strategy. Each timeout defaults to KINM_DB_*_TIMEOUT_SECONDS, if set.
+	Timeouts Timeouts
+	// CompactionInterval is how often the table is compacted. If zero, 15 minutes is used.
+	CompactionInterval time.Duration
+	// ExpiryInterval is how often objects that expired are deleted, see types.Expirer, and objects whose grace period
+	// ended are removed, see types.GracefulDeleter. If zero, 1 minute is used.
+	ExpiryInterval time.Duration
+	// DisableCompaction disables the periodic compaction of the table, for instance, if another process compacts it.
+	// Otherwise, the processes sharing the database elect one of them to compact each table.
+	DisableCompaction bool
+	// DisableExpiry disables the periodic deletion of expired objects, see types.Expirer, and the removal of objects
+	// whose grace period ended, see types.GracefulDeleter. Objects are then only removed when they are deleted
+	// without a grace period. Otherwise, the process elected to compact a table also deletes its expired objects.
+	DisableExpiry bool
+	// Dialect is the dialect of the database. If nil, it is detected from the driver of the database. CockroachDB
+	// can't be told apart from Postgres by its driver, statements.CockroachDB must be set explicitly for it.
+	Dialect statements.Dialect
+	// GenerateNameRetryLimit is how many times a create is retried with a new name if the name generated from
+	// metadata.generateName is taken. A negative value disables the retries. Defaults to
+	// KINM_GENERATE_NAME_COLLISION_RETRY_LIMIT or 5.
+	GenerateNameRetryLimit int
+	// PreCommitHooks are called in the transaction of every write, once the object is written. The hooks of the
+	// Factory defaults are called first.
+	PreCommitHooks []PreCommitHook
+	// PostCommitHooks are called once the transaction of a write commits. The hooks of the Factory defaults are
+	// called first.
+	PostCommitHooks []PostCommitHook
+
+	// readDB, if set, is used for reads outside a transaction.
+	readDB *sql.DB
+	// logger, if set, is used to log statements.
+	logger *glogrus.Logger
+	// factory, if set, is the Factory that created the strategy.
+	factory *Factory
+	// quotas, if set, are the quotas of the Factory.
+	quotas *quotas
+}
+
+func (o FactoryOptions) complete() FactoryOptions {
+	if o.MaxConnections == 0 {
+		o.MaxConnections = 5
+		if x, err := strconv.Atoi(os.Getenv("KINM_DB_CONNECTIONS")); err == nil && x > 0 {
+			o.MaxConnections = x
+		}
+		if x, err := strconv.Atoi(os.Getenv("KINM_DB_MAX_CONNECTIONS")); err == nil && x > 0 {
+			o.MaxConnections = x
+		}
+	}
+	if o.MaxIdleConnections == 0 {
+		o.MaxIdleConnections = 2
+		if x, err := strconv.Atoi(os.Getenv("KINM_DB_CONNECTIONS")); err == nil && x > 0 {
+			o.MaxIdleConnections = x
+		}
+		if x, err := strconv.Atoi(os.Getenv("KINM_DB_MAX_IDLE_CONNECTIONS")); err == nil && x > 0 {
+			o.MaxIdleConnections = x
+		}
+	}
+	if o.MaxConnectionLifetime == 0 {
+		o.MaxConnectionLifetime = 3 * time.Minute
+		if x, err := strconv.Atoi(os.Getenv("KINM_DB_MAX_CONNECTION_LIFETIME_SECONDS")); err == nil && x > 0 {
+			o.MaxConnectionLifetime = time.Duration(x) * time.Second
+		}
+	}
+	if o.SlowThreshold == 0 {
+		o.SlowThreshold = defaultSlowThreshold
+	}
+	if o.Logger == nil {
+		o.Logger = logrus.StandardLogger()
+	}
+	o.Strategy = o.Strategy.complete()
+	return o
+}
+
+func (o StrategyOptions) complete() StrategyOptions {
+	for env, timeout := range map[string]*time.Duration{
+		"KINM_DB_GET_TIMEOUT_SECONDS":        &o.Timeouts.Get,
+		"KINM_DB_LIST_TIMEOUT_SECONDS":       &o.Timeouts.List,
+		"KINM_DB_INSERT_TIMEOUT_SECONDS":     &o.Timeouts.Insert,
+		"KINM_DB_COMPACTION_TIMEOUT_SECONDS": &o.Timeouts.Compaction,
+		"KINM_DB_MIGRATION_TIMEOUT_SECONDS":  &o.Timeouts.Migration,
+	} {
+		if *timeout != 0 {
+			continue
+		}
+		if x, err := strconv.Atoi(os.Getenv(env)); err == nil && x > 0 {
+			*timeout = time.Duration(x) * time.Second
+		}
+	}
+	if o.CompactionInterval == 0 {
+		o.CompactionInterval = defaultCompactionInterval
+	}
+	if o.ExpiryInterval == 0 {
+		o.ExpiryInterval = defaultExpiryInterval
+	}
+	if o.GenerateNameRetryLimit == 0 {
+		o.GenerateNameRetryLimit = defaultGenerateNameRetryLimit
+		if x, err := strconv.Atoi(os.Getenv("KINM_GENERATE_NAME_COLLISION_RETRY_LIMIT")); err == nil {
+			o.GenerateNameRetryLimit = x
+		}
+	}
+	if o.logger == nil {
+		o.logger = glogrus.New(glogrus.Config{
+			SlowThreshold: defaultSlowThreshold,
+		})
+	}
+	return o
+}
+
+// merge returns o with its zero values replaced by the values of defaults.
+func (o StrategyOptions) merge(defaults StrategyOptions) StrategyOptions {
+	for _, timeout := range []struct{ value, def *time.Duration }{
+		{&o.Timeouts.Get, &defaults.Timeouts.Get},
+		{&o.Timeouts.List, &defaults.Timeouts.List},
+		{&o.Timeouts.Insert, &defaults.Timeouts.Insert},
+		{&o.Timeouts.Compaction, &defaults.Timeouts.Compaction},
+		{&o.Timeouts.Migration, &defaults.Timeouts.Migration},
+	} {
+		if *timeout.value == 0 {
+			*timeout.value = *timeout.def
+		}
+	}
+	if o.CompactionInterval == 0 {
+		o.CompactionInterval = defaults.CompactionInterval
+	}
+	if o.ExpiryInterval == 0 {
+		o.ExpiryInterval = defaults.ExpiryInterval
+	}
+	if o.GenerateNameRetryLimit == 0 {
+		o.GenerateNameRetryLimit = defaults.GenerateNameRetryLimit
+	}
+	o.DisableCompaction = o.DisableCompaction || defaults.DisableCompaction
+	o.DisableExpiry = o.DisableExpiry || defaults.DisableExpiry
+	if o.Dialect == nil {
+		o.Dialect = defaults.Dialect
+	}
+	o.PreCommitHooks = slices.Concat(defaults.PreCommitHooks, o.PreCommitHooks)
+	o.PostCommitHooks = slices.Concat(defaults.PostCommitHooks, o.PostCommitHooks)
+	if o.readDB == nil {
+		o.readDB = defaults.readDB
+	}
+	if o.logger == nil {
+		o.logger = defaults.logger
+	}
+	return o
+}
@@ -0,0 +1,300 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/obot-platform/kinm/pkg/db/errors"
+	"github.com/obot-platform/kinm/pkg/strategy"
+	"github.com/obot-platform/kinm/pkg/types"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apiserver/pkg/storage"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// QuotaFunc returns the limits of the quota of a namespace. Kinds that are not in Objects are not limited, nor are
+// bytes if Bytes is zero. It is called in the transaction of every write that changes the objects or bytes of a
+// namespace: the strategies of the Factory called with ctx read in the transaction.
+type QuotaFunc func(ctx context.Context, namespace string) (types.QuotaResources, error)
+
+// quotas enforces the QuotaFunc of a Factory across the kinds of its strategies. The usage of a namespace is only
+// tracked while the namespace has limits, so writers of the namespaces without limits are not serialized by it.
+type quotas struct {
+	limits  QuotaFunc
+	factory *Factory
+}
+
+// quotaUsage is the usage of a group/kind, or of every kind for the total.
+type quotaUsage struct {
+	objects, bytes int64
+}
+
+// chargeQuota adds objects and bytes to the usage of the namespace, and returns an error if that exceeds its quota.
+// The total usage of the namespace is charged first, the lock on its row serializes the writers of the namespace
+// until they commit, so concurrent writes can't exceed the quota together. Writes that don't add to the usage are
+// always allowed.
+func (d *db) chargeQuota(ctx context.Context, namespace, name string, objects, bytes int64) error {
+	if d.quotas == nil || namespace == "" || (objects == 0 && bytes == 0) {
+		return nil
+	}
+
+	limits, err := d.quotas.limits(ctx, namespace)
+	if err != nil {
+		return err
+	}
+	if len(limits.Objects) == 0 && limits.Bytes == 0 {
+		return d.quotas.untrack(ctx, d, namespace)
+	}
+	if err := d.quotas.track(ctx, d, namespace); err != nil {
+		return err
+	}
+
+	groupKind := d.gvk.GroupKind().String()
+	if _, err := d.execContext(ctx, d.stmt.ChargeQuotaSQL(), namespace, "", objects, bytes); err != nil {
+		return err
+	}
+	if _, err := d.execContext(ctx, d.stmt.ChargeQuotaSQL(), namespace, groupKind, objects, bytes); err != nil {
+		return err
+	}
+	if objects <= 0 && bytes <= 0 {
+		return nil
+	}
+
+	usage, err := d.quotaUsage(ctx, namespace)
+	if err != nil {
+		return err
+	}
+
+	if limit, ok := limits.Objects[groupKind]; ok && objects > 0 && usage[groupKind].objects > limit {
+		return errors.NewQuotaExceeded(d.gvk, name, fmt.Errorf("objects of %s in namespace %s, requested: %d, used: %d, limited: %d",
+			groupKind, namespace, objects, usage[groupKind].objects-objects, limit))
+	}
+	if limits.Bytes > 0 && bytes > 0 && usage[""].bytes > limits.Bytes {
+		return errors.NewQuotaExceeded(d.gvk, name, fmt.Errorf("bytes in namespace %s, requested: %d, used: %d, limited: %d",
+			namespace, bytes, usage[""].bytes-bytes, limits.Bytes))
+	}
+	return nil
+}
+
+// quotaUsage returns the tracked usage of every group/kind in the namespace. The total usage has the empty
+// group/kind.
+func (d *db) quotaUsage(ctx context.Context, namespace string) (map[string]quotaUsage, error) {
+	rows, err := d.queryContext(ctx, d.stmt.QuotaUsageSQL(), namespace)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := map[string]quotaUsage{}
+	for rows.Next() {
+		var (
+			groupKind string
+			usage     quotaUsage
+		)
+		if err := rows.Scan(&groupKind, &usage.objects, &usage.bytes); err != nil {
+			return nil, err
+		}
+		result[groupKind] = usage
+	}
+	return result, rows.Err()
+}
+
+// tracked returns true if the usage of the namespace is tracked.
+func (q *quotas) tracked(ctx context.Context, d *db, namespace string) (bool, error) {
+	var count int
+	if err := d.queryRowContext(ctx, d.stmt.QuotaTrackedSQL(), namespace).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// track starts tracking the usage of the namespace, if it is not tracked yet. The usage is counted in the
+// transaction that starts tracking it: concurrent writers of the namespace wait on its total row until it commits.
+func (q *quotas) track(ctx context.Context, d *db, namespace string) error {
+	result, err := d.execContext(ctx, d.stmt.TrackQuotaSQL(), namespace)
+	if err != nil {
+		return err
+	}
+	if inserted, err := result.RowsAffected(); err != nil || inserted == 0 {
+		return err
+	}
+
+	// Usage left from a previous tracking is replaced
+	if _, err := d.execContext(ctx, d.stmt.ResetQuotaSQL(), namespace); err != nil {
+		return err
+	}
+	usage, err := q.count(ctx, namespace)
+	if err != nil {
+		return err
+	}
+	for groupKind, u := range usage {
+		if _, err := d.execContext(ctx, d.stmt.ChargeQuotaSQL(), namespace, groupKind, u.objects, u.bytes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// untrack stops tracking the usage of the namespace, once it has no limits. The usage is only read, and nothing is
+// locked, if it is not tracked.
+func (q *quotas) untrack(ctx context.Context, d *db, namespace string) error {
+	if tracked, err := q.tracked(ctx, d, namespace); err != nil || !tracked {
+		return err
+	}
+	_, err := d.execContext(ctx, d.stmt.UntrackQuotaSQL(), namespace)
+	return err
+}
+
+// count counts the usage of every group/kind of the strategies of the Factory in the namespace, from their tables.
+// The total usage has the empty group/kind.
+func (q *quotas) count(ctx context.Context, namespace string) (map[string]quotaUsage, error) {
+	q.factory.strategiesLock.Lock()
+	tables := map[string]*db{}
+	for gvk, s := range q.factory.strategies {
+		tables[gvk.GroupKind().String()] = &s.db
+	}
+	q.factory.strategiesLock.Unlock()
+
+	result := map[string]quotaUsage{}
+	var total quotaUsage
+	for groupKind, d := range tables {
+		var usage quotaUsage
+		if err := d.queryRowContext(ctx, d.stmt.CountQuotaSQL(), namespace).Scan(&usage.objects, &usage.bytes); err != nil {
+			return nil, err
+		}
+		if usage.objects == 0 {
+			continue
+		}
+		result[groupKind] = usage
+		total.objects += usage.objects
+		total.bytes += usage.bytes
+	}
+	result[""] = total
+	return result, nil
+}
+
+// QuotaUsageStrategy serves the read only types.QuotaUsage kind. There is one QuotaUsage in every namespace, named
+// types.QuotaUsageName.
+type QuotaUsageStrategy struct {
+	db     db
+	quotas *quotas
+}
+
+var (
+	_ strategy.Getter = (*QuotaUsageStrategy)(nil)
+	_ strategy.Lister = (*QuotaUsageStrategy)(nil)
+)
+
+// NewQuotaUsageStrategy returns the strategy of the types.QuotaUsage kind, which must be in the scheme of the Factory.
+// Usage is only reported if FactoryOptions.Quotas is set.
+func (f *Factory) NewQuotaUsageStrategy() (*QuotaUsageStrategy, error) {
+	gvk, err := apiutil.GVKForObject(&types.QuotaUsage{}, f.schema)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &QuotaUsageStrategy{
+		db:     f.tx,
+		quotas: f.quotas,
+	}
+	s.db.gvk = gvk
+	return s, nil
+}
+
+func (s *QuotaUsageStrategy) New() types.Object {
+	return &types.QuotaUsage{}
+}
+
+func (s *QuotaUsageStrategy) NewList() types.ObjectList {
+	return &types.QuotaUsageList{}
+}
+
+func (s *QuotaUsageStrategy) Get(ctx context.Context, namespace, name string) (types.Object, error) {
+	if namespace == "" || name != types.QuotaUsageName {
+		return nil, errors.NewNotFound(s.db.gvk, name)
+	}
+
+	usage, err := s.usage(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &types.QuotaUsage{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      types.QuotaUsageName,
+			Namespace: namespace,
+		},
+	}
+	for groupKind, u := range usage {
+		if groupKind == "" {
+			result.Status.Used.Bytes = u.bytes
+			continue
+		}
+		if result.Status.Used.Objects == nil {
+			result.Status.Used.Objects = map[string]int64{}
+		}
+		result.Status.Used.Objects[groupKind] = u.objects
+	}
+	if s.quotas != nil {
+		if result.Status.Hard, err = s.quotas.limits(ctx, namespace); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// usage returns the usage of the namespace, which is counted from the tables of the strategies if it is not tracked.
+func (s *QuotaUsageStrategy) usage(ctx context.Context, namespace string) (map[string]quotaUsage, error) {
+	if s.quotas == nil {
+		return nil, nil
+	}
+	if tracked, err := s.quotas.tracked(ctx, &s.db, namespace); err != nil {
+		return nil, err
+	} else if tracked {
+		return s.db.quotaUsage(ctx, namespace)
+	}
+	return s.quotas.count(ctx, namespace)
+}
+
+// List returns the QuotaUsage of the namespace, or of every namespace whose usage is tracked if namespace is empty.
+func (s *QuotaUsageStrategy) List(ctx context.Context, namespace string, _ storage.ListOptions) (types.ObjectList, error) {
+	namespaces := []string{namespace}
+	if namespace == "" {
+		var err error
+		if namespaces, err = s.namespaces(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	objs := make([]runtime.Object, 0, len(namespaces))
+	for _, namespace := range namespaces {
+		obj, err := s.Get(ctx, namespace, types.QuotaUsageName)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, obj)
+	}
+
+	result := s.NewList()
+	return result, meta.SetList(result, objs)
+}
+
+func (s *QuotaUsageStrategy) namespaces(ctx context.Context) ([]string, error) {
+	rows, err := s.db.queryContext(ctx, s.db.stmt.QuotaNamespacesSQL())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []string
+	for rows.Next() {
+		var namespace string
+		if err := rows.Scan(&namespace); err != nil {
+			return nil, err
+		}
+		result = append(result, namespace)
+	}
+	return result, rows.Err()
+}
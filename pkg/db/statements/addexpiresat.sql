@@ -0,0 +1 @@
+ALTER TABLE placeholder ADD COLUMN expires_at BIGINT;
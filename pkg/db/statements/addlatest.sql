@@ -0,0 +1,5 @@
+ALTER TABLE placeholder ADD COLUMN latest INTEGER;
+
+UPDATE placeholder
+SET latest = 1
+WHERE id IN (SELECT max(id) FROM placeholder GROUP BY namespace, name);
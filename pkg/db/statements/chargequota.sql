@@ -0,0 +1,4 @@
+INSERT INTO quota_usage(namespace, group_kind, objects, bytes)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (namespace, group_kind) DO UPDATE SET objects = quota_usage.objects + excluded.objects,
+                                                  bytes   = quota_usage.bytes + excluded.bytes;
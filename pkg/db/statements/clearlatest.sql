@@ -0,0 +1,6 @@
+UPDATE placeholder
+SET latest     = NULL,
+    expires_at = NULL
+WHERE namespace = $1
+  AND name = $2
+  AND latest = 1;
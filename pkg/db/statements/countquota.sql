@@ -0,0 +1,5 @@
+SELECT COUNT(*), COALESCE(SUM(OCTET_LENGTH(value)), 0)
+FROM placeholder
+WHERE namespace = $1
+  AND latest = 1
+  AND deleted = 0;
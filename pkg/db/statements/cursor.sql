@@ -0,0 +1,4 @@
+SELECT id
+FROM cursors
+WHERE name = 'placeholder'
+  AND consumer = $1
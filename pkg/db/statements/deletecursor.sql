@@ -0,0 +1,4 @@
+DELETE
+FROM cursors
+WHERE name = 'placeholder'
+  AND consumer = $1;
@@ -0,0 +1,249 @@
+package statements
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// DefaultBusyTimeout is how long SQLite waits for a lock if no timeout is set.
+const DefaultBusyTimeout = 5 * time.Second
+
+// Dialect describes the differences between the databases supported by kinm. Statements that can't be written
+// portably are overridden by a file of the same name in the directory named after the dialect.
+type Dialect interface {
+	// Name is the name of the dialect and the directory of its statement overrides.
+	Name() string
+	// Quote quotes an identifier, like a table name.
+	Quote(identifier string) string
+	// Rebind rewrites the $n parameters that statements are written with to the style of the dialect. If the
+	// parameters of the rewritten statement are not numbered, it also returns the index of the argument for each of
+	// them, in order.
+	Rebind(sql string) (string, []int)
+	// Isolation returns the isolation level used for a transaction that requests level.
+	Isolation(level sql.IsolationLevel) sql.IsolationLevel
+	// LastInsertID is true if the id of an inserted record is read from the result of the insert, instead of a
+	// RETURNING clause.
+	LastInsertID() bool
+	// Timeout returns a statement that bounds how long the statements of the current transaction may run and wait
+	// for locks.
+	Timeout(timeout time.Duration) string
+	// SessionTimeout returns a statement that reads the setting of Timeout, if it outlives the transaction, so that
+	// it can be restored with RestoreTimeout before the transaction ends. An empty string is returned if the setting
+	// is local to the transaction.
+	SessionTimeout() string
+	// RestoreTimeout returns a statement that restores a setting read with SessionTimeout.
+	RestoreTimeout(value int64) string
+
+	// IsDuplicateKey returns true if err is a violation of a unique constraint.
+	IsDuplicateKey(err error) bool
+	// IsSchemaConflict returns true if err is caused by a migration adding a column or index that already exists, or
+	// dropping one that does not.
+	IsSchemaConflict(err error) bool
+	// IsRetryable returns true if err is a transient failure caused by contention with another transaction, in
+	// which case the transaction can be retried from the start.
+	IsRetryable(err error) bool
+	// IsTimeout returns true if err is caused by a statement timeout.
+	IsTimeout(err error) bool
+	// IsLockTimeout returns true if err is caused by a timeout waiting for a lock.
+	IsLockTimeout(err error) bool
+}
+
+var (
+	Postgres    Dialect = postgres{}
+	CockroachDB Dialect = cockroachDB{}
+	SQLite      Dialect = sqlite{}
+	MySQL       Dialect = mySQL{}
+)
+
+var numberedParam = regexp.MustCompile(`\$[0-9]+`)
+
+type sqlState interface {
+	SQLState() string
+}
+
+type sqlCode interface {
+	Code() int
+}
+
+func hasSQLState(err error, states ...string) bool {
+	var e sqlState
+	if !errors.As(err, &e) {
+		return false
+	}
+	for _, state := range states {
+		if e.SQLState() == state {
+			return true
+		}
+	}
+	return false
+}
+
+type postgres struct{}
+
+func (postgres) Name() string { return "postgres" }
+
+func (postgres) Quote(identifier string) string { return `"` + identifier + `"` }
+
+func (postgres) Rebind(sql string) (string, []int) { return sql, nil }
+
+func (postgres) Isolation(level sql.IsolationLevel) sql.IsolationLevel { return level }
+
+func (postgres) LastInsertID() bool { return false }
+
+func (postgres) Timeout(timeout time.Duration) string {
+	return fmt.Sprintf("SELECT set_config('statement_timeout', '%[1]dms', true), set_config('lock_timeout', '%[1]dms', true)", max(timeout.Milliseconds(), 1))
+}
+
+// SessionTimeout is empty because the settings of Timeout are local to the transaction.
+func (postgres) SessionTimeout() string { return "" }
+
+func (postgres) RestoreTimeout(int64) string { return "" }
+
+func (postgres) IsDuplicateKey(err error) bool { return hasSQLState(err, "23505") }
+
+// IsSchemaConflict checks for duplicate_column.
+func (postgres) IsSchemaConflict(err error) bool { return hasSQLState(err, "42701") }
+
+// IsRetryable checks for serialization_failure and deadlock_detected.
+func (postgres) IsRetryable(err error) bool { return hasSQLState(err, "40001", "40P01") }
+
+// IsTimeout checks for query_canceled, which is caused by statement_timeout.
+func (postgres) IsTimeout(err error) bool { return hasSQLState(err, "57014") }
+
+// IsLockTimeout checks for lock_not_available, which is caused by lock_timeout.
+func (postgres) IsLockTimeout(err error) bool { return hasSQLState(err, "55P03") }
+
+// cockroachDB is a Postgres compatible database that only runs serializable transactions. It has no table or
+// advisory locks, so instead of a sequence and a watermark, ids are allocated from the table like on SQLite. A
+// transaction that allocates an id conflicts with any other that allocated the same one, or read the table before
+// it, and is retried. That keeps ids gap-free and committed in order.
+type cockroachDB struct {
+	postgres
+}
+
+func (cockroachDB) Name() string { return "cockroachdb" }
+
+func (cockroachDB) Isolation(sql.IsolationLevel) sql.IsolationLevel { return sql.LevelSerializable }
+
+type sqlite struct{}
+
+func (sqlite) Name() string { return "sqlite" }
+
+func (sqlite) Quote(identifier string) string { return `"` + identifier + `"` }
+
+func (sqlite) Rebind(sql string) (string, []int) { return sql, nil }
+
+func (sqlite) Isolation(level sql.IsolationLevel) sql.IsolationLevel { return level }
+
+func (sqlite) LastInsertID() bool { return false }
+
+func (sqlite) Timeout(timeout time.Duration) string {
+	return fmt.Sprintf("PRAGMA busy_timeout = %d", max(timeout.Milliseconds(), 1))
+}
+
+// SessionTimeout reads the busy timeout, which is set on the connection and outlives the transaction. Unless a
+// transaction has a timeout, it is the one of the DSN.
+func (sqlite) SessionTimeout() string { return "PRAGMA busy_timeout" }
+
+func (sqlite) RestoreTimeout(value int64) string {
+	return fmt.Sprintf("PRAGMA busy_timeout = %d", value)
+}
+
+// IsDuplicateKey checks for SQLITE_CONSTRAINT_UNIQUE.
+func (sqlite) IsDuplicateKey(err error) bool {
+	var e sqlCode
+	return errors.As(err, &e) && e.Code() == 2067
+}
+
+func (sqlite) IsSchemaConflict(err error) bool {
+	var e sqlCode
+	return errors.As(err, &e) && e.Code() == 1 && strings.Contains(err.Error(), "duplicate column name")
+}
+
+// IsRetryable checks for SQLITE_BUSY and SQLITE_LOCKED, including their extended codes.
+func (sqlite) IsRetryable(err error) bool {
+	var e sqlCode
+	if !errors.As(err, &e) {
+		return false
+	}
+	switch e.Code() & 0xff {
+	case 5, 6:
+		return true
+	}
+	return false
+}
+
+func (sqlite) IsTimeout(error) bool { return false }
+
+// IsLockTimeout is false because a busy error is retried. It is only returned once the retries are exhausted.
+func (sqlite) IsLockTimeout(error) bool { return false }
+
+type mySQL struct{}
+
+func (mySQL) Name() string { return "mysql" }
+
+func (mySQL) Quote(identifier string) string { return "`" + identifier + "`" }
+
+// Rebind replaces each $n parameter with a ?, which is bound to the next argument. Parameters that are used more
+// than once are repeated in the arguments.
+func (mySQL) Rebind(sql string) (string, []int) {
+	var args []int
+	sql = numberedParam.ReplaceAllStringFunc(sql, func(param string) string {
+		n, _ := strconv.Atoi(param[1:])
+		args = append(args, n-1)
+		return "?"
+	})
+	return sql, args
+}
+
+func (mySQL) Isolation(level sql.IsolationLevel) sql.IsolationLevel { return level }
+
+func (mySQL) LastInsertID() bool { return true }
+
+func (mySQL) Timeout(timeout time.Duration) string {
+	// The lock wait timeout is in seconds. Statements are otherwise bounded by the context, the driver closes the
+	// connection once it is done.
+	return fmt.Sprintf("SET SESSION innodb_lock_wait_timeout = %d", max((timeout+time.Second-1)/time.Second, 1))
+}
+
+// SessionTimeout reads the lock wait timeout, which is set on the connection and outlives the transaction.
+func (mySQL) SessionTimeout() string { return "SELECT @@SESSION.innodb_lock_wait_timeout" }
+
+func (mySQL) RestoreTimeout(value int64) string {
+	return fmt.Sprintf("SET SESSION innodb_lock_wait_timeout = %d", value)
+}
+
+func hasErrorNumber(err error, numbers ...uint16) bool {
+	var e *mysql.MySQLError
+	if !errors.As(err, &e) {
+		return false
+	}
+	for _, number := range numbers {
+		if e.Number == number {
+			return true
+		}
+	}
+	return false
+}
+
+// IsDuplicateKey checks for ER_DUP_ENTRY.
+func (mySQL) IsDuplicateKey(err error) bool { return hasErrorNumber(err, 1062) }
+
+// IsSchemaConflict checks for ER_DUP_FIELDNAME, ER_DUP_KEYNAME and ER_CANT_DROP_FIELD_OR_KEY.
+func (mySQL) IsSchemaConflict(err error) bool { return hasErrorNumber(err, 1060, 1061, 1091) }
+
+// IsRetryable checks for ER_LOCK_DEADLOCK.
+func (mySQL) IsRetryable(err error) bool { return hasErrorNumber(err, 1213) }
+
+// IsTimeout checks for ER_QUERY_TIMEOUT.
+func (mySQL) IsTimeout(err error) bool { return hasErrorNumber(err, 3024) }
+
+// IsLockTimeout checks for ER_LOCK_WAIT_TIMEOUT.
+func (mySQL) IsLockTimeout(err error) bool { return hasErrorNumber(err, 1205) }
@@ -0,0 +1,13 @@
+SELECT id,
+       name,
+       namespace,
+       previous_id,
+       uid,
+       CASE WHEN created = 1 OR previous_id IS NULL THEN 1 ELSE 0 END AS created,
+       deleted,
+       value
+FROM placeholder
+WHERE expires_at <= $1
+  AND latest = 1
+  AND deleted = 0
+ORDER BY expires_at
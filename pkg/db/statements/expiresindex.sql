@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS placeholder_expires_at ON placeholder (expires_at);
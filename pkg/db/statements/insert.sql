@@ -1,4 +1,4 @@
-INSERT INTO placeholder(id, name, namespace, previous_id, uid, created, deleted, value extra_fields)
+INSERT INTO placeholder(id, name, namespace, previous_id, uid, created, deleted, value, latest, expires_at extra_fields)
 VALUES ((SELECT COALESCE(MAX(id), 0) + 1 FROM placeholder),
         $1,
         $2,
@@ -6,4 +6,6 @@ VALUES ((SELECT COALESCE(MAX(id), 0) + 1 FROM placeholder),
         $4,
         $5,
         $6,
-        $7 extra_vals) RETURNING id;
\ No newline at end of file
+        $7,
+        1,
+        $8 extra_vals) RETURNING id;
\ No newline at end of file
@@ -0,0 +1,3 @@
+CREATE UNIQUE INDEX IF NOT EXISTS placeholder_unique_name_namespace_latest ON placeholder (namespace, name, latest);
+
+CREATE INDEX IF NOT EXISTS placeholder_latest_id ON placeholder (latest, id);
@@ -0,0 +1,3 @@
+SELECT holder
+FROM leases
+WHERE name = $1;
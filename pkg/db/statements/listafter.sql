@@ -14,4 +14,5 @@ FROM placeholder
 WHERE (namespace = $1 OR $1 IS NULL)
   AND (name = $2 OR $2 IS NULL) extra_fields
   AND id > $3
+  AND ($4 = 0 OR id <= $4)
 ORDER BY id
\ No newline at end of file
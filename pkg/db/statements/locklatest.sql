@@ -0,0 +1,8 @@
+SELECT id,
+       deleted,
+       value
+FROM placeholder
+WHERE namespace = $1
+  AND name = $2
+  AND latest = 1
+FOR SHARE;
@@ -8,6 +8,8 @@ CREATE TABLE IF NOT EXISTS placeholder
     created     INTEGER,
     deleted     INTEGER       DEFAULT 0 NOT NULL,
     value       TEXT NOT NULL DEFAULT '',
+    latest      INTEGER,
+    expires_at  BIGINT,
     CONSTRAINT placeholder_unique_name_namespace_created UNIQUE (name, namespace, created)
 );
 
@@ -16,3 +18,27 @@ CREATE TABLE IF NOT EXISTS compaction
     name VARCHAR(255) NOT NULL UNIQUE,
     id   INTEGER
 );
+
+CREATE TABLE IF NOT EXISTS cursors
+(
+    name     VARCHAR(255) NOT NULL,
+    consumer VARCHAR(255) NOT NULL,
+    id       INTEGER NOT NULL,
+    CONSTRAINT cursors_unique_name_consumer UNIQUE (name, consumer)
+);
+
+CREATE TABLE IF NOT EXISTS quota_usage
+(
+    namespace  VARCHAR(255) NOT NULL,
+    group_kind VARCHAR(255) NOT NULL,
+    objects    BIGINT NOT NULL,
+    bytes      BIGINT NOT NULL,
+    CONSTRAINT quota_usage_unique_namespace_group_kind UNIQUE (namespace, group_kind)
+);
+
+CREATE TABLE IF NOT EXISTS leases
+(
+    name       VARCHAR(255) NOT NULL UNIQUE,
+    holder     VARCHAR(255) NOT NULL,
+    expires_at BIGINT NOT NULL
+);
@@ -0,0 +1,3 @@
+SELECT min(id)
+FROM cursors
+WHERE name = 'placeholder'
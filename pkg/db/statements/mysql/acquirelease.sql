@@ -0,0 +1,4 @@
+INSERT INTO leases(name, holder, expires_at)
+VALUES ($1, $2, $3)
+ON DUPLICATE KEY UPDATE holder     = IF(holder = VALUES(holder) OR expires_at < $4, VALUES(holder), holder),
+                        expires_at = IF(holder = VALUES(holder), VALUES(expires_at), expires_at);
@@ -0,0 +1 @@
+ALTER TABLE placeholder ADD COLUMN new_column VARCHAR(255);
\ No newline at end of file
@@ -0,0 +1 @@
+CREATE INDEX idx_placeholder_field_names ON placeholder (extra_fields);
\ No newline at end of file
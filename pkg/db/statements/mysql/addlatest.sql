@@ -0,0 +1,5 @@
+ALTER TABLE placeholder ADD COLUMN latest INTEGER;
+
+UPDATE placeholder AS r
+    JOIN (SELECT max(id) AS id FROM placeholder GROUP BY namespace, name) AS m ON r.id = m.id
+SET r.latest = 1;
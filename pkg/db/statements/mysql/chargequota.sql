@@ -0,0 +1,4 @@
+INSERT INTO quota_usage(namespace, group_kind, objects, bytes)
+VALUES ($1, $2, $3, $4)
+ON DUPLICATE KEY UPDATE objects = objects + VALUES(objects),
+                        bytes   = bytes + VALUES(bytes);
@@ -0,0 +1,4 @@
+SELECT 1 FROM information_schema.columns
+WHERE table_name = 'placeholder'
+AND table_schema = DATABASE()
+AND (column_name = 'new_column' OR column_name = 'new_column_lower');
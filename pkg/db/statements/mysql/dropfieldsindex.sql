@@ -0,0 +1 @@
+DROP INDEX idx_placeholder_field_names ON placeholder;
\ No newline at end of file
@@ -0,0 +1 @@
+CREATE INDEX placeholder_expires_at ON placeholder (expires_at);
@@ -0,0 +1,10 @@
+INSERT INTO placeholder(name, namespace, previous_id, uid, created, deleted, value, latest, expires_at extra_fields)
+VALUES ($1,
+        $2,
+        $3,
+        $4,
+        $5,
+        $6,
+        $7,
+        1,
+        $8 extra_vals);
@@ -0,0 +1,3 @@
+ALTER TABLE placeholder
+    ADD UNIQUE INDEX placeholder_unique_name_namespace_latest (namespace, name, latest),
+    ADD INDEX placeholder_latest_id (latest, id);
@@ -0,0 +1,47 @@
+CREATE TABLE IF NOT EXISTS placeholder
+(
+    id          BIGINT AUTO_INCREMENT PRIMARY KEY,
+    name        VARCHAR(255) NOT NULL,
+    namespace   VARCHAR(255) NOT NULL,
+    previous_id BIGINT UNIQUE,
+    uid         VARCHAR(255) NOT NULL,
+    created     INTEGER,
+    deleted     INTEGER DEFAULT 0 NOT NULL,
+    value       LONGTEXT NOT NULL,
+    latest      INTEGER,
+    expires_at  BIGINT,
+    CONSTRAINT placeholder_unique_name_namespace_created UNIQUE (name, namespace, created)
+);
+
+CREATE TABLE IF NOT EXISTS compaction
+(
+    name VARCHAR(255) NOT NULL UNIQUE,
+    id   BIGINT
+);
+
+CREATE TABLE IF NOT EXISTS cursors
+(
+    name     VARCHAR(255) NOT NULL,
+    consumer VARCHAR(255) NOT NULL,
+    id       BIGINT NOT NULL,
+    CONSTRAINT cursors_unique_name_consumer UNIQUE (name, consumer)
+);
+
+CREATE TABLE IF NOT EXISTS quota_usage
+(
+    namespace  VARCHAR(255) NOT NULL,
+    group_kind VARCHAR(255) NOT NULL,
+    objects    BIGINT NOT NULL,
+    bytes      BIGINT NOT NULL,
+    CONSTRAINT quota_usage_unique_namespace_group_kind UNIQUE (namespace, group_kind)
+);
+
+CREATE TABLE IF NOT EXISTS leases
+(
+    name       VARCHAR(255) NOT NULL UNIQUE,
+    holder     VARCHAR(255) NOT NULL,
+    expires_at BIGINT NOT NULL
+);
+
+INSERT IGNORE INTO compaction(name, id)
+VALUES ('placeholder', NULL);
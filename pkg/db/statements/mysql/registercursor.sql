@@ -0,0 +1,2 @@
+INSERT IGNORE INTO cursors(name, consumer, id)
+SELECT 'placeholder', $1, COALESCE((SELECT c.id FROM compaction AS c WHERE c.name = 'placeholder'), 0);
@@ -0,0 +1,2 @@
+INSERT IGNORE INTO quota_usage(namespace, group_kind, objects, bytes)
+VALUES ($1, '', 0, 0);
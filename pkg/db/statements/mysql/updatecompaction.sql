@@ -0,0 +1,4 @@
+INSERT INTO compaction(name, id)
+SELECT 'placeholder', m.max_id
+FROM (SELECT coalesce(max(r.id), 1) AS max_id FROM placeholder AS r WHERE ($1 = 0 OR r.id <= $1)) AS m
+ON DUPLICATE KEY UPDATE id = m.max_id;
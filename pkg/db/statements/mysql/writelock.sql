@@ -0,0 +1,3 @@
+SELECT id
+FROM compaction
+WHERE name = 'placeholder' FOR UPDATE
@@ -0,0 +1,11 @@
+INSERT INTO placeholder(id, name, namespace, previous_id, uid, created, deleted, value, latest, expires_at extra_fields)
+VALUES (nextval('placeholder_id_seq'),
+        $1,
+        $2,
+        $3,
+        $4,
+        $5,
+        $6,
+        $7,
+        1,
+        $8 extra_vals) RETURNING id;
\ No newline at end of file
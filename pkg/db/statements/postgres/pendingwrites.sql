@@ -0,0 +1,6 @@
+SELECT min($1::BIGINT - ((($1::BIGINT - objid::BIGINT + 1073741824) % 2147483648 + 2147483648) % 2147483648 - 1073741824))
+FROM pg_locks
+WHERE locktype = 'advisory'
+  AND database = (SELECT oid FROM pg_database WHERE datname = current_database())
+  AND classid = lock_key
+  AND objsubid = 2
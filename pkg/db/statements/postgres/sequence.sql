@@ -0,0 +1,5 @@
+CREATE SEQUENCE IF NOT EXISTS placeholder_id_seq;
+
+SELECT setval('placeholder_id_seq', max_id)
+FROM (SELECT max(id) AS max_id FROM placeholder) AS t
+WHERE max_id > (SELECT CASE WHEN is_called THEN last_value ELSE last_value - 1 END FROM placeholder_id_seq);
@@ -0,0 +1 @@
+SELECT CASE WHEN is_called THEN last_value ELSE last_value - 1 END FROM placeholder_id_seq
@@ -0,0 +1,2 @@
+SELECT pg_advisory_xact_lock_shared(lock_key,
+    ((SELECT CASE WHEN is_called THEN last_value ELSE last_value - 1 END FROM placeholder_id_seq) % 2147483648)::INTEGER)
@@ -0,0 +1,3 @@
+SELECT DISTINCT namespace
+FROM quota_usage
+ORDER BY namespace;
@@ -0,0 +1,4 @@
+SELECT COUNT(*)
+FROM quota_usage
+WHERE namespace = $1
+  AND group_kind = '';
@@ -0,0 +1,4 @@
+SELECT group_kind, objects, bytes
+FROM quota_usage
+WHERE namespace = $1
+ORDER BY group_kind;
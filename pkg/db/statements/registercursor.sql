@@ -0,0 +1,4 @@
+INSERT INTO cursors(name, consumer, id)
+SELECT 'placeholder', $1, COALESCE((SELECT c.id FROM compaction AS c WHERE c.name = 'placeholder'), 0)
+WHERE true
+ON CONFLICT (name, consumer) DO NOTHING;
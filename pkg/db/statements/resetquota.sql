@@ -0,0 +1,4 @@
+DELETE
+FROM quota_usage
+WHERE namespace = $1
+  AND group_kind <> '';
@@ -0,0 +1,2 @@
+SELECT 1 FROM pragma_table_info('placeholder')
+WHERE name = 'new_column' OR name = 'new_column_lower';
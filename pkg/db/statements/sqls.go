@@ -5,28 +5,62 @@ import (
 	_ "embed"
 	"fmt"
 	"strings"
+	"time"
 )
 
-//go:embed *.sql
+//go:embed *.sql postgres/*.sql mysql/*.sql sqlite/*.sql
 var fs embed.FS
 
-func (s *Statements) CreateSQL() string { return s.statements["migrate.sql"] }
+// Statement is a SQL statement and the name of the file it was loaded from, which identifies the statement in logs
+// and traces without including the SQL.
+type Statement struct {
+	Name string
+	SQL  string
 
-func (s *Statements) CheckColumnSQL(name string) string {
+	// args is the index of the argument bound to each parameter, if the parameters of the dialect are not numbered.
+	args []int
+}
+
+// Args returns the arguments in the order they are bound to the parameters of the statement.
+func (s Statement) Args(args ...any) []any {
+	if s.args == nil {
+		return args
+	}
+	bound := make([]any, 0, len(s.args))
+	for _, i := range s.args {
+		bound = append(bound, args[i])
+	}
+	return bound
+}
+
+// statement returns the statement loaded from the named file, or an empty statement if the dialect doesn't need it.
+func (s *Statements) statement(name string) Statement {
+	return s.statements[name]
+}
+
+func (s *Statements) CreateSQL() Statement { return s.statement("migrate.sql") }
+
+func (s *Statements) CheckColumnSQL(name string) Statement {
 	name = strings.ReplaceAll(name, ".", "_")
-	return strings.Replace(
-		strings.Replace(s.statements["checkcolumn.sql"], "new_column", name, 1),
-		// Some databases transform the column name to lowercase. Check that too.
-		"new_column_lower", strings.ToLower(name),
-		1,
-	)
+	return Statement{
+		Name: "checkcolumn.sql",
+		SQL: strings.Replace(
+			strings.Replace(s.statements["checkcolumn.sql"].SQL, "new_column", name, 1),
+			// Some databases transform the column name to lowercase. Check that too.
+			"new_column_lower", strings.ToLower(name),
+			1,
+		),
+	}
 }
 
-func (s *Statements) AddColumnSQL(name string) string {
-	return strings.Replace(s.statements["addcolumn.sql"], "new_column", strings.ReplaceAll(name, ".", "_"), 1)
+func (s *Statements) AddColumnSQL(name string) Statement {
+	return Statement{
+		Name: "addcolumn.sql",
+		SQL:  strings.Replace(s.statements["addcolumn.sql"].SQL, "new_column", strings.ReplaceAll(name, ".", "_"), 1),
+	}
 }
 
-func (s *Statements) AddFieldsIndexSQL(fields []string) string {
+func (s *Statements) AddFieldsIndexSQL(fields []string) Statement {
 	var fieldsToIndex string
 	for _, f := range fields {
 		if f != "" {
@@ -37,31 +71,145 @@ func (s *Statements) AddFieldsIndexSQL(fields []string) string {
 	fieldsToIndex = strings.TrimPrefix(fieldsToIndex, ", ")
 
 	if fieldsToIndex == "" {
-		return ""
+		return Statement{}
 	}
 
-	return strings.Replace(s.statements["addfieldsindex.sql"], "extra_fields", fieldsToIndex, 1)
+	return Statement{
+		Name: "addfieldsindex.sql",
+		SQL:  strings.Replace(s.statements["addfieldsindex.sql"].SQL, "extra_fields", fieldsToIndex, 1),
+	}
 }
 
-func (s *Statements) DropFieldsIndexSQL() string { return s.statements["dropfieldsindex.sql"] }
+// AddLatestSQL adds the latest column to a table created before it existed and marks the latest revision of
+// every object.
+func (s *Statements) AddLatestSQL() Statement { return s.statement("addlatest.sql") }
+
+// AddExpiresAtSQL adds the expires_at column to a table created before it existed.
+func (s *Statements) AddExpiresAtSQL() Statement { return s.statement("addexpiresat.sql") }
+
+func (s *Statements) ExpiresIndexSQL() Statement { return s.statement("expiresindex.sql") }
+
+func (s *Statements) LatestIndexSQL() Statement { return s.statement("latestindex.sql") }
+
+func (s *Statements) DropFieldsIndexSQL() Statement { return s.statement("dropfieldsindex.sql") }
+
+func (s *Statements) InsertSQL() Statement { return s.statement("insert.sql") }
+
+func (s *Statements) TableMetaSQL() Statement { return s.statement("tablemeta.sql") }
+
+func (s *Statements) ClearLatestSQL() Statement { return s.statement("clearlatest.sql") }
+
+// LockLatestSQL returns the latest revision of an object, locked until the transaction ends so that it can't be
+// updated until then. SQLite has a single writer, its transactions are serialized already.
+func (s *Statements) LockLatestSQL() Statement { return s.statement("locklatest.sql") }
+
+func (s *Statements) ClearCreatedSQL() Statement { return s.statement("clearcreated.sql") }
+
+func (s *Statements) UpdateCompactionSQL() Statement { return s.statement("updatecompaction.sql") }
+
+func (s *Statements) CompactSQL() Statement { return s.statement("compact.sql") }
+
+// RegisterCursorSQL adds the cursor of a consumer of the change log, at the start of the log, unless it exists. The
+// start of the log is the last compaction, the changes before it may have been removed.
+func (s *Statements) RegisterCursorSQL() Statement { return s.statement("registercursor.sql") }
+
+func (s *Statements) CursorSQL() Statement { return s.statement("cursor.sql") }
 
-func (s *Statements) InsertSQL() string { return s.statements["insert.sql"] }
+// UpdateCursorSQL moves the cursor of a consumer forward.
+func (s *Statements) UpdateCursorSQL() Statement { return s.statement("updatecursor.sql") }
 
-func (s *Statements) TableMetaSQL() string { return s.statements["tablemeta.sql"] }
+func (s *Statements) DeleteCursorSQL() Statement { return s.statement("deletecursor.sql") }
 
-func (s *Statements) ClearCreatedSQL() string { return s.statements["clearcreated.sql"] }
+// MinCursorSQL returns the cursor of the slowest consumer, or NULL if there are no consumers.
+func (s *Statements) MinCursorSQL() Statement { return s.statement("mincursor.sql") }
 
-func (s *Statements) UpdateCompactionSQL() string { return s.statements["updatecompaction.sql"] }
+// AcquireLeaseSQL takes a lease until a time, if it is free, expired before a time or already held by the holder.
+func (s *Statements) AcquireLeaseSQL() Statement { return s.statement("acquirelease.sql") }
 
-func (s *Statements) CompactSQL() string { return s.statements["compact.sql"] }
+// LeaseHolderSQL returns the holder of a lease.
+func (s *Statements) LeaseHolderSQL() Statement { return s.statement("leaseholder.sql") }
 
-func (s *Statements) listSQL() string { return s.statements["list.sql"] }
+// ReleaseLeaseSQL frees a lease, if it is held by the holder.
+func (s *Statements) ReleaseLeaseSQL() Statement { return s.statement("releaselease.sql") }
 
-func (s *Statements) listAfterSQL() string { return s.statements["listafter.sql"] }
+// ChargeQuotaSQL adds to the usage of a group/kind in a namespace, or of every kind for the empty group/kind. The
+// row of the usage is locked until the transaction ends, which serializes the writers that charge it.
+func (s *Statements) ChargeQuotaSQL() Statement { return s.statement("chargequota.sql") }
+
+// QuotaUsageSQL returns the usage of every group/kind in a namespace, the total usage has the empty group/kind.
+func (s *Statements) QuotaUsageSQL() Statement { return s.statement("quotausage.sql") }
+
+// QuotaNamespacesSQL returns the namespaces whose usage is tracked.
+func (s *Statements) QuotaNamespacesSQL() Statement { return s.statement("quotanamespaces.sql") }
+
+// QuotaTrackedSQL returns 1 if the usage of a namespace is tracked, 0 otherwise.
+func (s *Statements) QuotaTrackedSQL() Statement { return s.statement("quotatracked.sql") }
+
+// TrackQuotaSQL starts tracking the usage of a namespace with an empty total usage. It inserts nothing if the usage
+// is already tracked.
+func (s *Statements) TrackQuotaSQL() Statement { return s.statement("trackquota.sql") }
+
+// ResetQuotaSQL removes the usage of every group/kind in a namespace, before it is counted again.
+func (s *Statements) ResetQuotaSQL() Statement { return s.statement("resetquota.sql") }
+
+// UntrackQuotaSQL stops tracking the usage of a namespace.
+func (s *Statements) UntrackQuotaSQL() Statement { return s.statement("untrackquota.sql") }
+
+// CountQuotaSQL counts the objects of the table in a namespace, and their bytes.
+func (s *Statements) CountQuotaSQL() Statement { return s.statement("countquota.sql") }
+
+func (s *Statements) expiredSQL() Statement { return s.statement("expired.sql") }
+
+func (s *Statements) listSQL() Statement { return s.statement("list.sql") }
+
+func (s *Statements) listLatestSQL() Statement { return s.statement("listlatest.sql") }
+
+func (s *Statements) listAfterSQL() Statement { return s.statement("listafter.sql") }
+
+// WriteLockSQL is run by writers before they insert a record. On Postgres, it registers the calling transaction as a
+// pending writer of the table. The lock is keyed by the last id allocated from the sequence modulo 2^31, so readers can
+// find the lowest id that may still be committed with PendingWritesSQL. On MySQL, it serializes the writers of the table, so
+// ids are committed in order.
+func (s *Statements) WriteLockSQL() Statement {
+	return s.statement("writelock.sql")
+}
+
+// SequenceSQL creates the sequence ids are allocated from and moves it past any existing rows.
+func (s *Statements) SequenceSQL() Statement {
+	return s.statement("sequence.sql")
+}
+
+// SequenceValueSQL returns the last id allocated from the sequence, or 0 if none has been allocated.
+func (s *Statements) SequenceValueSQL() Statement {
+	return s.statement("sequencevalue.sql")
+}
+
+// PendingWritesSQL returns the lowest id held by a pending writer, or NULL if there are none. It takes the last id
+// allocated from the sequence, which the ids of the locks are recovered from.
+func (s *Statements) PendingWritesSQL() Statement {
+	return s.statement("pendingwrites.sql")
+}
+
+// TimeoutSQL bounds how long the statements of the current transaction may run and wait for locks.
+func (s *Statements) TimeoutSQL(timeout time.Duration) Statement {
+	return Statement{
+		Name: "timeout",
+		SQL:  s.dialect.Timeout(timeout),
+	}
+}
+
+// SessionTimeoutSQL reads the setting of TimeoutSQL if it outlives the transaction, or is empty if it does not.
+func (s *Statements) SessionTimeoutSQL() Statement {
+	return Statement{
+		Name: "sessiontimeout",
+		SQL:  s.dialect.SessionTimeout(),
+	}
+}
 
-func (s *Statements) TableLockSQL() string {
-	if s.lock {
-		return s.statements["tablelock.sql"]
+// RestoreTimeoutSQL restores a setting read with SessionTimeoutSQL.
+func (s *Statements) RestoreTimeoutSQL(value int64) Statement {
+	return Statement{
+		Name: "restoretimeout",
+		SQL:  s.dialect.RestoreTimeout(value),
 	}
-	return ""
 }
@@ -2,45 +2,63 @@ package statements
 
 import (
 	_ "embed"
+	"errors"
 	"fmt"
+	"hash/crc32"
+	iofs "io/fs"
+	"path"
 	"strconv"
 	"strings"
 )
 
 type Statements struct {
+	dialect    Dialect
 	tableName  string
-	statements map[string]string
-	lock       bool
+	statements map[string]Statement
 }
 
-func New(tableName string, extraFieldNames []string, lock bool) *Statements {
+func New(dialect Dialect, tableName string, extraFieldNames []string) *Statements {
 	s := &Statements{
+		dialect:    dialect,
 		tableName:  tableName,
-		statements: map[string]string{},
-		lock:       lock,
+		statements: map[string]Statement{},
 	}
-	entries, err := fs.ReadDir(".")
-	if err != nil {
-		panic("failed to read sql files: " + err.Error())
-	}
-	for _, entry := range entries {
-		if entry.IsDir() {
+	// Statements of the dialect override the portable statements with the same name.
+	for _, dir := range []string{".", dialect.Name()} {
+		entries, err := fs.ReadDir(dir)
+		if errors.Is(err, iofs.ErrNotExist) {
 			continue
+		} else if err != nil {
+			panic("failed to read sql files: " + err.Error())
 		}
-		sql, err := fs.ReadFile(entry.Name())
-		if err != nil {
-			panic("failed to read sql file: " + err.Error())
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			sql, err := fs.ReadFile(path.Join(dir, entry.Name()))
+			if err != nil {
+				panic("failed to read sql file: " + err.Error())
+			}
+			s.initSQL(entry.Name(), sql, extraFieldNames)
 		}
-		s.initSQL(entry.Name(), sql, extraFieldNames)
 	}
 	return s
 }
 
+// Dialect returns the dialect the statements are written for.
+func (s *Statements) Dialect() Dialect {
+	return s.dialect
+}
+
 func (s *Statements) initSQL(name string, sqlData []byte, extraFieldNames []string) {
+	sql := string(sqlData)
+
 	// This is hacky, sue me
-	sql := strings.ReplaceAll(string(sqlData), "'placeholder'", fmt.Sprintf(`'%s'`, s.tableName))
-	sql = strings.ReplaceAll(sql, "placeholder", fmt.Sprintf(`"%s"`, s.tableName))
-	sql = strings.ReplaceAll(sql, fmt.Sprintf(`"%s"_`, s.tableName), fmt.Sprintf(`%s_`, s.tableName))
+	sql = strings.ReplaceAll(sql, "'placeholder'", fmt.Sprintf(`'%s'`, s.tableName))
+	sql = strings.ReplaceAll(sql, "placeholder_", fmt.Sprintf(`%s_`, s.tableName))
+	sql = strings.ReplaceAll(sql, "placeholder", s.dialect.Quote(s.tableName))
+
+	sql = strings.ReplaceAll(sql, "lock_key", strconv.FormatInt(lockKey(s.tableName), 10))
 
 	transformedExtraFieldNames := make([]string, len(extraFieldNames))
 	for i := range extraFieldNames {
@@ -56,32 +74,52 @@ func (s *Statements) initSQL(name string, sqlData []byte, extraFieldNames []stri
 		} else {
 			sql = strings.Replace(sql, "field_names", "", 1)
 		}
-	case "listafter.sql":
+	case "listlatest.sql":
 		sql = strings.Replace(sql, "extra_fields", extraFieldsWithIndexOffset(transformedExtraFieldNames, 4), 1)
+	case "listafter.sql":
+		sql = strings.Replace(sql, "extra_fields", extraFieldsWithIndexOffset(transformedExtraFieldNames, 5), 1)
 	case "insert.sql":
 		var extraFields, extraVals string
 		for i, f := range transformedExtraFieldNames {
 			extraFields += fmt.Sprintf(", %s", f)
-			extraVals += fmt.Sprintf(", $%d", i+8)
+			extraVals += fmt.Sprintf(", $%d", i+9)
 		}
 		sql = strings.Replace(strings.Replace(sql, "extra_vals", extraVals, 1), "extra_fields", extraFields, 1)
 	}
 
-	s.statements[name] = strings.TrimSpace(sql)
+	sql, args := s.dialect.Rebind(strings.TrimSpace(sql))
+	s.statements[name] = Statement{
+		Name: name,
+		SQL:  sql,
+		args: args,
+	}
 }
 
-func (s *Statements) ListSQL(limit int64) string {
-	if limit > 0 {
-		return s.listSQL() + " LIMIT " + strconv.FormatInt(limit+1, 10)
-	}
-	return s.listSQL()
+func (s *Statements) ListSQL(limit int64) Statement {
+	return withLimit(s.listSQL(), limit)
+}
+
+func (s *Statements) ListLatestSQL(limit int64) Statement {
+	return withLimit(s.listLatestSQL(), limit)
+}
+
+func (s *Statements) ListAfterSQL(limit int64) Statement {
+	return withLimit(s.listAfterSQL(), limit)
 }
 
-func (s *Statements) ListAfterSQL(limit int64) string {
+// ExpiredSQL returns the latest revisions of the objects that expired at or before a time, in the order they
+// expired.
+func (s *Statements) ExpiredSQL(limit int64) Statement {
+	stmt := s.expiredSQL()
+	stmt.SQL += " LIMIT " + strconv.FormatInt(limit, 10)
+	return stmt
+}
+
+func withLimit(stmt Statement, limit int64) Statement {
 	if limit > 0 {
-		return s.listAfterSQL() + " LIMIT " + strconv.FormatInt(limit+1, 10)
+		stmt.SQL += " LIMIT " + strconv.FormatInt(limit+1, 10)
 	}
-	return s.listAfterSQL()
+	return stmt
 }
 
 func extraFieldsWithIndexOffset(extraFields []string, offset int) string {
@@ -93,3 +131,8 @@ func extraFieldsWithIndexOffset(extraFields []string, offset int) string {
 
 	return extraFieldsStr
 }
+
+// lockKey returns the advisory lock key used by writers of the table.
+func lockKey(tableName string) int64 {
+	return int64(crc32.ChecksumIEEE([]byte(tableName)) & 0x7fffffff)
+}
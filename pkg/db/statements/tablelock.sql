@@ -1 +0,0 @@
-LOCK TABLE placeholder IN EXCLUSIVE MODE
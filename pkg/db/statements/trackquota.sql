@@ -0,0 +1,3 @@
+INSERT INTO quota_usage(namespace, group_kind, objects, bytes)
+VALUES ($1, '', 0, 0)
+ON CONFLICT (namespace, group_kind) DO NOTHING;
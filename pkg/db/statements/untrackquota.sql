@@ -0,0 +1,3 @@
+DELETE
+FROM quota_usage
+WHERE namespace = $1;
@@ -1,4 +1,4 @@
 INSERT INTO compaction(name, id)
 VALUES ('placeholder',
-    (SELECT coalesce(max(r.id), 1) FROM placeholder AS r))
+    (SELECT coalesce(max(r.id), 1) FROM placeholder AS r WHERE ($1 = 0 OR r.id <= $1)))
 ON CONFLICT (name) DO UPDATE SET id = EXCLUDED.id;
@@ -0,0 +1,5 @@
+UPDATE cursors
+SET id = $2
+WHERE name = 'placeholder'
+  AND consumer = $1
+  AND id < $2;
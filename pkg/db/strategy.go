@@ -19,6 +19,7 @@ import (
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -28,11 +29,11 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/apiserver/pkg/storage"
-	"k8s.io/klog/v2"
 )
 
 var (
-	_ strategy.CompleteStrategy = (*Strategy)(nil)
+	_ strategy.CompleteStrategy  = (*Strategy)(nil)
+	_ strategy.CollectionDeleter = (*Strategy)(nil)
 
 	tracer = otel.Tracer("kinm/db")
 )
@@ -43,6 +44,11 @@ type Strategy struct {
 	objListTemplate  types.ObjectList
 	scheme           *runtime.Scheme
 	cancelCompaction func()
+	preCommitHooks   []PreCommitHook
+	postCommitHooks  []PostCommitHook
+	// factory is the Factory that created the strategy, if any.
+	factory                *Factory
+	generateNameRetryLimit int
 
 	broadcastLock sync.Mutex
 	broadcast     chan struct{}
@@ -56,6 +62,11 @@ type record struct {
 	vals             []any
 	created, deleted int16
 	value            string
+	// expiresAt is the unix time after which the object is deleted, if set.
+	expiresAt *int64
+	// encode, if set, returns the value of an update from the latest record of the object, which the update replaces.
+	// It is called in the transaction of the update, once the latest record is checked.
+	encode func(latest record) (string, error)
 }
 
 func (r *record) Unmarshal(obj types.Object) error {
@@ -67,6 +78,12 @@ func (r *record) Unmarshal(obj types.Object) error {
 }
 
 func New(ctx context.Context, sqlDB *sql.DB, gvk schema.GroupVersionKind, scheme *runtime.Scheme, tableName string) (*Strategy, error) {
+	return NewWithOptions(ctx, sqlDB, gvk, scheme, tableName, StrategyOptions{})
+}
+
+func NewWithOptions(ctx context.Context, sqlDB *sql.DB, gvk schema.GroupVersionKind, scheme *runtime.Scheme, tableName string, opts StrategyOptions) (*Strategy, error) {
+	opts = opts.complete()
+
 	objTemplate, err := scheme.New(gvk)
 	if err != nil {
 		return nil, err
@@ -86,10 +103,22 @@ func New(ctx context.Context, sqlDB *sql.DB, gvk schema.GroupVersionKind, scheme
 		indexFields = o.IndexFields()
 	}
 
+	dialect := opts.Dialect
+	if dialect == nil {
+		if dialect, err = dialectOf(sqlDB); err != nil {
+			return nil, err
+		}
+	}
+
 	newDB := db{
-		sqlDB: sqlDB,
-		stmt:  statements.New(tableName, fieldNames, sqlDB.Stats().MaxOpenConnections != 1),
-		gvk:   gvk,
+		sqlDB:      sqlDB,
+		readDB:     opts.readDB,
+		timeouts:   opts.Timeouts,
+		logger:     opts.logger,
+		stmt:       statements.New(dialect, tableName, fieldNames),
+		gvk:        gvk,
+		quotas:     opts.quotas,
+		watermarks: &watermarkCache{},
 	}
 
 	if err = newDB.migrate(ctx, fieldNames, indexFields); err != nil {
@@ -97,33 +126,96 @@ func New(ctx context.Context, sqlDB *sql.DB, gvk schema.GroupVersionKind, scheme
 	}
 
 	s := &Strategy{
-		db:              newDB,
-		objTemplate:     objTemplate.(types.Object),
-		objListTemplate: objListTemplate.(types.ObjectList),
-		scheme:          scheme,
-		broadcast:       make(chan struct{}),
+		db:                     newDB,
+		objTemplate:            objTemplate.(types.Object),
+		objListTemplate:        objListTemplate.(types.ObjectList),
+		scheme:                 scheme,
+		preCommitHooks:         opts.PreCommitHooks,
+		postCommitHooks:        opts.PostCommitHooks,
+		factory:                opts.factory,
+		generateNameRetryLimit: opts.GenerateNameRetryLimit,
+		broadcast:              make(chan struct{}),
+	}
+
+	if opts.DisableCompaction && opts.DisableExpiry {
+		s.cancelCompaction = func() {}
+		return s, nil
 	}
 
 	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
 	go func() {
-		ticker := time.NewTicker(15 * time.Minute)
+		defer close(done)
+		s.maintain(ctx, tableName, opts)
+	}()
+
+	s.cancelCompaction = func() {
+		cancel()
+		<-done
+	}
+	return s, nil
+}
+
+// maintain compacts the table and deletes the expired objects until ctx is done. The processes sharing the
+// database elect one of them to do it with the lease of the table, which is renewed on every tick.
+func (s *Strategy) maintain(ctx context.Context, tableName string, opts StrategyOptions) {
+	var (
+		compaction, expiry <-chan time.Time
+		interval           time.Duration
+	)
+	if !opts.DisableCompaction {
+		ticker := time.NewTicker(opts.CompactionInterval)
 		defer ticker.Stop()
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case <-ticker.C:
-				if count, err := s.db.compact(ctx); err != nil {
-					klog.Errorf("failed to compact %q: %v", tableName, err)
-				} else if count > 0 {
-					klog.Infof("compacted %q: %d records", tableName, count)
-				}
-			}
+		compaction, interval = ticker.C, opts.CompactionInterval
+	}
+	if !opts.DisableExpiry {
+		ticker := time.NewTicker(opts.ExpiryInterval)
+		defer ticker.Stop()
+		expiry = ticker.C
+		if interval == 0 || opts.ExpiryInterval < interval {
+			interval = opts.ExpiryInterval
+		}
+	}
+
+	// The lease outlives two ticks, so it is only taken over if the leader missed a renewal.
+	l := newLease(&s.db, tableName, 2*interval)
+	defer func() {
+		if err := l.release(context.WithoutCancel(ctx)); err != nil {
+			s.db.logger.Error(ctx, "failed to release the lease of %q: %v", tableName, err)
 		}
 	}()
+	leader := func() bool {
+		held, err := l.acquire(ctx)
+		if err != nil && ctx.Err() == nil {
+			s.db.logger.Error(ctx, "failed to acquire the lease of %q: %v", tableName, err)
+		}
+		return held
+	}
 
-	s.cancelCompaction = cancel
-	return s, nil
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-compaction:
+			if !leader() {
+				continue
+			}
+			if count, err := s.db.compact(ctx); err != nil {
+				s.db.logger.Error(ctx, "failed to compact %q: %v", tableName, err)
+			} else if count > 0 {
+				s.db.logger.Info(ctx, "compacted %q: %d records", tableName, count)
+			}
+		case <-expiry:
+			if !leader() {
+				continue
+			}
+			if count, err := s.expire(ctx); err != nil {
+				s.db.logger.Error(ctx, "failed to delete expired objects of %q: %v", tableName, err)
+			} else if count > 0 {
+				s.db.logger.Info(ctx, "deleted expired objects of %q: %d objects", tableName, count)
+			}
+		}
+	}
 }
 
 func (s *Strategy) Create(ctx context.Context, object types.Object) (types.Object, error) {
@@ -134,7 +226,7 @@ func (s *Strategy) Create(ctx context.Context, object types.Object) (types.Objec
 		return nil, fmt.Errorf("object must have a UID")
 	}
 
-	defer s.broadcastChange()
+	defer onCommit(ctx, s.broadcastChange)
 
 	// On create all objects have a generation of 1
 	object.SetGeneration(1)
@@ -154,21 +246,51 @@ func (s *Strategy) Create(ctx context.Context, object types.Object) (types.Objec
 		}
 	}
 
-	id, err := s.db.insert(ctx, record{
-		name:      object.GetName(),
-		namespace: object.GetNamespace(),
-		uid:       string(object.GetUID()),
-		created:   1,
-		vals:      vals,
-		value:     buf.String(),
-	})
+	expiresAt, err := objectExpiry(object)
 	if err != nil {
 		return nil, err
 	}
 
-	result := object.DeepCopyObject().(types.Object)
-	result.SetResourceVersion(strconv.FormatInt(id, 10))
-	return result, nil
+	return s.withHooks(ctx, func(ctx context.Context) (types.Object, watch.EventType, error) {
+		rec := record{
+			name:      object.GetName(),
+			namespace: object.GetNamespace(),
+			uid:       string(object.GetUID()),
+			created:   1,
+			vals:      vals,
+			value:     buf.String(),
+			expiresAt: expiresAt,
+		}
+		ctx, cancel := withTimeout(ctx, s.db.timeouts.Insert)
+		defer cancel()
+
+		var id int64
+		err := s.db.inTx(ctx, &sql.TxOptions{
+			Isolation: sql.LevelRepeatableRead,
+		}, func(ctx context.Context) (err error) {
+			// The namespace was checked before the create, it's checked again in its transaction in case it was
+			// deleted since.
+			if rec.namespace != "" && s.factory != nil {
+				if err := s.factory.lockNamespace(ctx, rec.namespace); err != nil {
+					return err
+				}
+			}
+			id, err = s.db.insert(ctx, rec)
+			return err
+		})
+		if err != nil {
+			return nil, "", err
+		}
+
+		result := object.DeepCopyObject().(types.Object)
+		result.SetResourceVersion(strconv.FormatInt(id, 10))
+		return result, watch.Added, nil
+	})
+}
+
+// GenerateNameRetryLimit implements strategy.GenerateNameRetryLimiter.
+func (s *Strategy) GenerateNameRetryLimit() int {
+	return max(s.generateNameRetryLimit, 0)
 }
 
 func (s *Strategy) New() types.Object {
@@ -199,10 +321,52 @@ func (s *Strategy) Update(ctx context.Context, obj types.Object) (types.Object,
 	ctx, span := kotel.StartSpanIfParent(ctx, tracer, "dbStrategyUpdate", trace.WithAttributes(kotel.ObjectToAttributes(obj, attribute.String("gvk", s.db.gvk.String()))...))
 	defer span.End()
 
-	defer s.broadcastChange()
+	defer onCommit(ctx, s.broadcastChange)
 	return s.doUpdate(ctx, obj, true)
 }
 
+// setGeneration sets the generation of obj to the generation of latest, the record obj replaces, bumped if the spec
+// of obj changed, see types.SpecChanger.
+func (s *Strategy) setGeneration(obj types.Object, latest record) error {
+	existing := s.New()
+	if err := latest.Unmarshal(existing); err != nil {
+		return err
+	}
+
+	changed, err := specChanged(obj, existing)
+	if err != nil {
+		return err
+	}
+	generation := existing.GetGeneration()
+	if changed {
+		generation++
+	}
+	obj.SetGeneration(generation)
+	return nil
+}
+
+// specChanged returns true if anything but the metadata and status of obj differs from old.
+func specChanged(obj, old types.Object) (bool, error) {
+	if o, ok := obj.(types.SpecChanger); ok {
+		return o.SpecChanged(old), nil
+	}
+
+	spec, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return false, err
+	}
+	oldSpec, err := runtime.DefaultUnstructuredConverter.ToUnstructured(old)
+	if err != nil {
+		return false, err
+	}
+	for _, fields := range []map[string]any{spec, oldSpec} {
+		for _, field := range []string{"apiVersion", "kind", "metadata", "status"} {
+			delete(fields, field)
+		}
+	}
+	return !equality.Semantic.DeepEqual(spec, oldSpec), nil
+}
+
 func (s *Strategy) doUpdate(ctx context.Context, obj types.Object, updateGeneration bool) (types.Object, error) {
 	var (
 		buf             strings.Builder
@@ -220,9 +384,6 @@ func (s *Strategy) doUpdate(ctx context.Context, obj types.Object, updateGenerat
 	}
 
 	obj = obj.DeepCopyObject().(types.Object)
-	if updateGeneration {
-		obj.SetGeneration(obj.GetGeneration() + 1)
-	}
 	// All stored objects have a resource version of 0
 	obj.SetResourceVersion("0")
 
@@ -245,26 +406,63 @@ func (s *Strategy) doUpdate(ctx context.Context, obj types.Object, updateGenerat
 		vals:       vals,
 		value:      buf.String(),
 	}
-
-	var id int64
-	if obj.GetDeletionTimestamp() != nil && len(obj.GetFinalizers()) == 0 {
-		id, err = s.db.delete(ctx, rec)
-	} else {
-		id, err = s.db.insert(ctx, rec)
+	if updateGeneration {
+		rec.encode = func(latest record) (string, error) {
+			if err := s.setGeneration(obj, latest); err != nil {
+				return "", err
+			}
+			buf.Reset()
+			err := json.NewEncoder(&buf).Encode(obj)
+			return buf.String(), err
+		}
 	}
-	if err != nil {
-		return nil, err
+
+	switch {
+	case obj.GetDeletionTimestamp() == nil:
+		if rec.expiresAt, err = objectExpiry(obj); err != nil {
+			return nil, err
+		}
+	case inGracePeriod(obj):
+		// The object is removed by the expiry once its grace period ends
+		expiresAt := obj.GetDeletionTimestamp().Unix()
+		rec.expiresAt = &expiresAt
 	}
 
-	obj.SetResourceVersion(strconv.FormatInt(id, 10))
-	return obj, nil
+	return s.withHooks(ctx, func(ctx context.Context) (types.Object, watch.EventType, error) {
+		var (
+			id        int64
+			eventType = watch.Modified
+		)
+		if obj.GetDeletionTimestamp() != nil && len(obj.GetFinalizers()) == 0 && !inGracePeriod(obj) {
+			id, err = s.db.delete(ctx, rec)
+			eventType = watch.Deleted
+		} else {
+			id, err = s.db.insert(ctx, rec)
+		}
+		if err != nil {
+			return nil, "", err
+		}
+
+		obj.SetResourceVersion(strconv.FormatInt(id, 10))
+		if id == resourceVersion {
+			// The object is unchanged, so nothing was written
+			return obj, "", nil
+		}
+		return obj, eventType, nil
+	})
 }
 
 func (s *Strategy) UpdateStatus(ctx context.Context, obj types.Object) (types.Object, error) {
 	ctx, span := kotel.StartSpanIfParent(ctx, tracer, "dbStrategyUpdateStatus", trace.WithAttributes(kotel.ObjectToAttributes(obj, attribute.String("gvk", s.db.gvk.String()))...))
 	defer span.End()
 
-	defer s.broadcastChange()
+	defer onCommit(ctx, s.broadcastChange)
+	return s.doUpdate(ctx, obj, false)
+}
+
+// updateMetadata updates obj without changing its generation, like the metadata updates of the garbage collector.
+func (s *Strategy) updateMetadata(ctx context.Context, obj types.Object) (types.Object, error) {
+	defer onCommit(ctx, s.broadcastChange)
 	return s.doUpdate(ctx, obj, false)
 }
 
@@ -343,7 +541,7 @@ func (s *Strategy) Delete(ctx context.Context, obj types.Object) (types.Object,
 	ctx, span := kotel.StartSpanIfParent(ctx, tracer, "dbStrategyDelete", trace.WithAttributes(kotel.ObjectToAttributes(obj, attribute.String("gvk", s.db.gvk.String()))...))
 	defer span.End()
 
-	defer s.broadcastChange()
+	defer onCommit(ctx, s.broadcastChange)
 	if obj.GetDeletionTimestamp() == nil {
 		now := metav1.Now()
 		obj.SetDeletionTimestamp(&now)
@@ -352,6 +550,48 @@ func (s *Strategy) Delete(ctx context.Context, obj types.Object) (types.Object,
 	return s.doUpdate(ctx, obj, false)
 }
 
+// DeleteCollection deletes the objects of namespace that match opts with strategy.DeleteEach. Each object is read
+// again in the transaction that deletes it, the ones that changed since they were listed are only deleted if they
+// still match. A failed object fails the DeleteCollection, the objects before it stay deleted.
+func (s *Strategy) DeleteCollection(ctx context.Context, namespace string, opts storage.ListOptions, prepare strategy.PrepareDeleteFunc) (types.ObjectList, error) {
+	ctx, span := kotel.StartSpanIfParent(ctx, tracer, "dbStrategyDeleteCollection", trace.WithAttributes(kotel.ListOptionsToAttributes(opts, attribute.String("gvk", s.db.gvk.String()), attribute.String("namespace", namespace))...))
+	defer span.End()
+
+	return strategy.DeleteEach(ctx, s, func(ctx context.Context, listed types.Object) (deleted types.Object, err error) {
+		return deleted, s.db.inTx(ctx, &sql.TxOptions{
+			Isolation: sql.LevelRepeatableRead,
+		}, func(ctx context.Context) error {
+			deleted, err = s.deleteMatching(ctx, listed, opts, prepare)
+			return err
+		})
+	}, namespace, opts, func(_ context.Context, obj types.Object) (types.Object, error) {
+		// The stored version is prepared by deleteMatching
+		return obj, nil
+	})
+}
+
+// deleteMatching deletes the stored version of listed, if it still matches opts. It returns nil if nothing is deleted.
+func (s *Strategy) deleteMatching(ctx context.Context, listed types.Object, opts storage.ListOptions, prepare strategy.PrepareDeleteFunc) (types.Object, error) {
+	obj, err := s.Get(ctx, listed.GetNamespace(), listed.GetName())
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if obj.GetUID() != listed.GetUID() {
+		// Deleted and created again since it was listed
+		return nil, nil
+	}
+	if match, err := opts.Predicate.Matches(obj); err != nil || !match {
+		return nil, err
+	}
+
+	if obj, err = prepare(ctx, obj); err != nil || obj == nil {
+		return nil, err
+	}
+	return s.Delete(ctx, obj)
+}
+
 func (s *Strategy) Watch(ctx context.Context, namespace string, opts storage.ListOptions) (<-chan watch.Event, error) {
 	ctx, span := kotel.StartSpanIfParent(ctx, tracer, "dbStrategyWatch", trace.WithAttributes(kotel.ListOptionsToAttributes(opts, attribute.String("gvk", s.db.gvk.String()), attribute.String("namespace", namespace))...))
 	defer span.End()
@@ -477,9 +717,20 @@ func (s *Strategy) streamWatch(ctx context.Context, namespace string, opts stora
 
 func (s *Strategy) Destroy() {
 	s.cancelCompaction()
+	if s.factory != nil {
+		// The pools are shared by the strategies of the Factory, they are closed by Factory.Close
+		s.factory.unregister(s)
+		return
+	}
 	s.db.Close()
 }
 
+// GarbageCollected returns true if the garbage collector of the Factory that created the strategy runs, see
+// Factory.CollectGarbage.
+func (s *Strategy) GarbageCollected() bool {
+	return s.factory != nil && s.factory.GarbageCollected()
+}
+
 func (s *Strategy) Scheme() *runtime.Scheme {
 	return s.scheme
 }
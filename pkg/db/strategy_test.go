@@ -1,10 +1,20 @@
 package db
 
 import (
+	"bufio"
 	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/obot-platform/kinm/pkg/db/cdc"
+	"github.com/obot-platform/kinm/pkg/strategy"
 	"github.com/obot-platform/kinm/pkg/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -16,6 +26,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	ktypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/watch"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
 	"k8s.io/apiserver/pkg/storage"
 	kclient "sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -93,8 +104,7 @@ func newStrategy(t *testing.T) *Strategy {
 	schema.AddKnownTypes(testGVK.GroupVersion(), &TestKind{}, &TestKindList{})
 
 	db := newDatabase(t)
-	_, err := db.sqlDB.Exec("DROP TABLE IF EXISTS strategytest")
-	require.NoError(t, err)
+	dropTable(t, db.sqlDB, "strategytest", db.stmt.Dialect())
 	s, err := New(ctx, db.sqlDB, testGVK, schema, "strategytest")
 	require.NoError(t, err)
 
@@ -296,6 +306,37 @@ func TestWatchRv(t *testing.T) {
 	assert.Equal(t, "testname3", event.Object.(kclient.Object).GetName())
 }
 
+func TestWatchRvPaged(t *testing.T) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	s := newStrategy(t)
+
+	count := watchBatchSize + 10
+	for i := range count {
+		suffix := strconv.Itoa(i + 4)
+		_, err := s.Create(ctx, &TestKind{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "testname" + suffix,
+				Namespace: "testnamespace",
+				UID:       ktypes.UID("testuid" + suffix),
+			},
+		})
+		require.NoError(t, err)
+	}
+
+	w, err := s.Watch(ctx, "", storage.ListOptions{
+		ResourceVersion: "3",
+	})
+	require.NoError(t, err)
+
+	for i := range count {
+		event := <-w
+		assert.Equal(t, watch.Added, event.Type)
+		assert.Equal(t, strconv.Itoa(i+4), event.Object.(kclient.Object).GetResourceVersion())
+	}
+}
+
 func TestWatchChanges(t *testing.T) {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
@@ -397,3 +438,973 @@ func TestContinue(t *testing.T) {
 	assert.Equal(t, "", list.Continue)
 
 }
+
+func TestSQLiteReadPool(t *testing.T) {
+	if os.Getenv("KINM_TEST_DB") != "" {
+		t.Skip("the read pool is only used with sqlite")
+	}
+
+	schema := runtime.NewScheme()
+	schema.AddKnownTypes(testGVK.GroupVersion(), &TestKind{}, &TestKindList{})
+
+	f, err := NewFactory(schema, "sqlite://"+filepath.Join(t.TempDir(), "kinm.db"))
+	require.NoError(t, err)
+	require.NotNil(t, f.ReadDB)
+	t.Cleanup(func() { _ = f.Close() })
+
+	cs, err := f.NewDBStrategy(&TestKind{})
+	require.NoError(t, err)
+	s := cs.(*Strategy)
+
+	_, err = s.Create(ctx, &TestKind{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: "default",
+			UID:       "testuid",
+		},
+	})
+	require.NoError(t, err)
+
+	// Hold the only writer connection in an open write transaction
+	tx, err := f.SQLDB.BeginTx(ctx, nil)
+	require.NoError(t, err)
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	_, err = tx.Exec("UPDATE testkind SET value = value")
+	require.NoError(t, err)
+
+	listCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	result, err := s.List(listCtx, "", storage.ListOptions{})
+	require.NoError(t, err)
+	assert.Len(t, result.(*TestKindList).Items, 1)
+
+	obj, err := s.Get(listCtx, "default", "test")
+	require.NoError(t, err)
+	assert.Equal(t, "test", obj.GetName())
+}
+
+func TestFactoryOptions(t *testing.T) {
+	schema := runtime.NewScheme()
+	schema.AddKnownTypes(testGVK.GroupVersion(), &TestKind{}, &TestKindList{})
+
+	f := newTestFactory(t, schema, FactoryOptions{
+		MaxConnections: 3,
+		TablePrefix:    "prefix_",
+		Strategy: StrategyOptions{
+			DisableCompaction:      true,
+			GenerateNameRetryLimit: 2,
+		},
+	})
+
+	if f.ReadDB != nil {
+		assert.Equal(t, 1, f.SQLDB.Stats().MaxOpenConnections)
+		assert.Equal(t, 3, f.ReadDB.Stats().MaxOpenConnections)
+	} else {
+		assert.Equal(t, 3, f.SQLDB.Stats().MaxOpenConnections)
+	}
+
+	cs, err := f.NewDBStrategyWithOptions(&TestKind{}, StrategyOptions{
+		Timeouts: Timeouts{
+			Get: time.Minute,
+		},
+	})
+	require.NoError(t, err)
+	s := cs.(*Strategy)
+	assert.Equal(t, time.Minute, s.db.timeouts.Get)
+	assert.Equal(t, 2, s.GenerateNameRetryLimit())
+
+	var count int
+	require.NoError(t, f.SQLDB.QueryRow("SELECT count(*) FROM prefix_testkind").Scan(&count))
+	assert.Equal(t, 0, count)
+}
+
+func TestFactoryTransaction(t *testing.T) {
+	schema := runtime.NewScheme()
+	schema.AddKnownTypes(testGVK.GroupVersion(), &TestKind{}, &TestKindList{})
+
+	f := newTestFactory(t, schema, FactoryOptions{
+		Strategy: StrategyOptions{
+			DisableCompaction: true,
+		},
+	})
+
+	cs, err := f.NewDBStrategy(&TestKind{})
+	require.NoError(t, err)
+	s := cs.(*Strategy)
+	dropTestTable(t, f, "othertestkind")
+	other, err := NewWithOptions(ctx, f.SQLDB, testGVK, schema, "othertestkind", StrategyOptions{DisableCompaction: true})
+	require.NoError(t, err)
+
+	newObj := func(name string) *TestKind {
+		return &TestKind{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				UID:       ktypes.UID(name + "uid"),
+			},
+		}
+	}
+
+	// A failed transaction rolls back every operation
+	err = f.Transaction(ctx, func(ctx context.Context) error {
+		if _, err := s.Create(ctx, newObj("first")); err != nil {
+			return err
+		}
+		_, err := s.Create(ctx, newObj("first"))
+		return err
+	})
+	assert.True(t, apierrors.IsAlreadyExists(err))
+	_, err = s.Get(ctx, "default", "first")
+	assert.True(t, apierrors.IsNotFound(err))
+
+	changed := s.waitChange()
+	err = f.Transaction(ctx, func(ctx context.Context) error {
+		if _, err := s.Create(ctx, newObj("first")); err != nil {
+			return err
+		}
+		if _, err := other.Create(ctx, newObj("second")); err != nil {
+			return err
+		}
+
+		// Watches are not notified before the commit
+		select {
+		case <-changed:
+			t.Error("watches notified before commit")
+		default:
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	select {
+	case <-changed:
+	default:
+		t.Error("watches not notified after commit")
+	}
+
+	_, err = s.Get(ctx, "default", "first")
+	require.NoError(t, err)
+	_, err = other.Get(ctx, "default", "second")
+	require.NoError(t, err)
+}
+
+func TestStrategyHooks(t *testing.T) {
+	schema := runtime.NewScheme()
+	schema.AddKnownTypes(testGVK.GroupVersion(), &TestKind{}, &TestKindList{})
+
+	f := newTestFactory(t, schema, FactoryOptions{
+		Strategy: StrategyOptions{
+			DisableCompaction: true,
+		},
+	})
+
+	var (
+		s         *Strategy
+		preCommit []watch.EventType
+		committed []watch.EventType
+	)
+	cs, err := f.NewDBStrategyWithOptions(&TestKind{}, StrategyOptions{
+		PreCommitHooks: []PreCommitHook{PreCommitHookFunc(func(ctx context.Context, event watch.Event) error {
+			obj := event.Object.(*TestKind)
+			if obj.Value == "rejected" {
+				return apierrors.NewBadRequest("rejected")
+			}
+			// The write is visible in the transaction
+			if event.Type != watch.Deleted {
+				stored, err := s.Get(ctx, obj.Namespace, obj.Name)
+				if err != nil {
+					return err
+				}
+				assert.Equal(t, obj.ResourceVersion, stored.GetResourceVersion())
+			}
+			preCommit = append(preCommit, event.Type)
+			return nil
+		})},
+		PostCommitHooks: []PostCommitHook{PostCommitHookFunc(func(ctx context.Context, event watch.Event) {
+			committed = append(committed, event.Type)
+		})},
+	})
+	require.NoError(t, err)
+	s = cs.(*Strategy)
+
+	obj, err := s.Create(ctx, &TestKind{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: "default",
+			UID:       "testuid",
+		},
+	})
+	require.NoError(t, err)
+
+	rejected := obj.DeepCopyObject().(*TestKind)
+	rejected.Value = "rejected"
+	_, err = s.Update(ctx, rejected)
+	assert.True(t, apierrors.IsBadRequest(err))
+
+	stored, err := s.Get(ctx, "default", "test")
+	require.NoError(t, err)
+	assert.Equal(t, obj.GetResourceVersion(), stored.GetResourceVersion())
+
+	// An update that changes nothing writes nothing, so the hooks are not called
+	unchanged, err := s.Update(ctx, stored)
+	require.NoError(t, err)
+	assert.Equal(t, stored.GetResourceVersion(), unchanged.GetResourceVersion())
+
+	_, err = s.Delete(ctx, stored)
+	require.NoError(t, err)
+
+	assert.Equal(t, []watch.EventType{watch.Added, watch.Deleted}, preCommit)
+	assert.Equal(t, []watch.EventType{watch.Added, watch.Deleted}, committed)
+}
+
+func TestConsume(t *testing.T) {
+	schema := runtime.NewScheme()
+	schema.AddKnownTypes(testGVK.GroupVersion(), &TestKind{}, &TestKindList{})
+
+	f := newTestFactory(t, schema, FactoryOptions{
+		Strategy: StrategyOptions{
+			DisableCompaction: true,
+		},
+	})
+
+	cs, err := f.NewDBStrategy(&TestKind{})
+	require.NoError(t, err)
+	s := cs.(*Strategy)
+
+	create := func(name string) types.Object {
+		obj, err := s.Create(ctx, &TestKind{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				UID:       ktypes.UID(name + "uid"),
+			},
+		})
+		require.NoError(t, err)
+		return obj
+	}
+
+	first := create("first")
+	_, err = s.Delete(ctx, first)
+	require.NoError(t, err)
+
+	events := make(chan cdc.Event)
+	consumeCtx, cancel := context.WithCancel(ctx)
+	done := make(chan error)
+	go func() {
+		done <- s.Consume(consumeCtx, "test", cdc.SinkFunc(func(ctx context.Context, batch []cdc.Event) error {
+			for _, event := range batch {
+				events <- event
+			}
+			return nil
+		}))
+	}()
+
+	var received []cdc.Event
+	for range 2 {
+		received = append(received, <-events)
+	}
+	second := create("second")
+	received = append(received, <-events)
+	cancel()
+	require.NoError(t, <-done)
+
+	assert.Equal(t, watch.Added, received[0].Type)
+	assert.Equal(t, watch.Deleted, received[1].Type)
+	assert.Equal(t, watch.Added, received[2].Type)
+	assert.Equal(t, "second", received[2].Object.(*TestKind).Name)
+	assert.Equal(t, "TestKind", received[2].Kind)
+
+	var cursor string
+	require.NoError(t, f.SQLDB.QueryRow("SELECT id FROM cursors WHERE name = 'testkind' AND consumer = 'test'").Scan(&cursor))
+	assert.Equal(t, second.GetResourceVersion(), cursor)
+
+	var buf strings.Builder
+	require.NoError(t, cdc.NewNDJSONSink(&buf).Send(ctx, received))
+	assert.Len(t, strings.Split(strings.TrimSpace(buf.String()), "\n"), 3)
+	assert.Contains(t, buf.String(), `"type":"DELETED"`)
+
+	// Compaction does not pass the slowest consumer
+	_, err = f.SQLDB.Exec("INSERT INTO cursors(name, consumer, id) VALUES ('testkind', 'idle', 0)")
+	require.NoError(t, err)
+	_, err = s.db.compact(ctx)
+	require.NoError(t, err)
+	meta, err := s.db.getTableMeta(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, meta.CompactionID)
+
+	require.NoError(t, s.RemoveConsumer(ctx, "idle"))
+	_, err = s.db.compact(ctx)
+	require.NoError(t, err)
+	meta, err = s.db.getTableMeta(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, second.GetResourceVersion(), strconv.FormatInt(meta.CompactionID, 10))
+
+	// A new consumer starts at the compaction
+	consumeCtx, cancel = context.WithCancel(ctx)
+	go func() {
+		done <- s.Consume(consumeCtx, "late", cdc.SinkFunc(func(ctx context.Context, batch []cdc.Event) error {
+			for _, event := range batch {
+				events <- event
+			}
+			return nil
+		}))
+	}()
+	create("third")
+	assert.Equal(t, "third", (<-events).Object.(*TestKind).Name)
+	cancel()
+	require.NoError(t, <-done)
+
+	// A consumer whose changes were compacted fails
+	_, err = f.SQLDB.Exec("INSERT INTO cursors(name, consumer, id) VALUES ('testkind', 'stale', 0)")
+	require.NoError(t, err)
+	err = s.Consume(ctx, "stale", cdc.SinkFunc(func(context.Context, []cdc.Event) error {
+		return nil
+	}))
+	assert.True(t, apierrors.IsResourceExpired(err))
+}
+
+type OtherKind struct {
+	TestKind
+}
+
+func (o *OtherKind) DeepCopyObject() runtime.Object {
+	return &OtherKind{
+		TestKind: *o.TestKind.DeepCopyObject().(*TestKind),
+	}
+}
+
+type OtherKindList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []OtherKind `json:"items"`
+}
+
+func (o *OtherKindList) DeepCopyObject() runtime.Object {
+	return &OtherKindList{}
+}
+
+func TestFeed(t *testing.T) {
+	schema := runtime.NewScheme()
+	schema.AddKnownTypes(testGVK.GroupVersion(), &TestKind{}, &TestKindList{}, &OtherKind{}, &OtherKindList{})
+
+	f := newTestFactory(t, schema, FactoryOptions{
+		Strategy: StrategyOptions{
+			DisableCompaction: true,
+		},
+	})
+
+	testKinds, err := f.NewDBStrategy(&TestKind{})
+	require.NoError(t, err)
+	otherKinds, err := f.NewDBStrategy(&OtherKind{})
+	require.NoError(t, err)
+	assert.Len(t, f.Kinds(), 2)
+
+	objectMeta := func(name string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			UID:       ktypes.UID(name + "uid"),
+		}
+	}
+
+	// Changes before the feed starts are not included
+	_, err = testKinds.Create(ctx, &TestKind{ObjectMeta: objectMeta("before")})
+	require.NoError(t, err)
+
+	feedCtx, cancel := context.WithCancel(ctx)
+	events, err := f.Feed(feedCtx, FeedOptions{})
+	require.NoError(t, err)
+
+	_, err = testKinds.Create(ctx, &TestKind{ObjectMeta: objectMeta("first")})
+	require.NoError(t, err)
+	first := <-events
+	assert.Equal(t, "TestKind", first.Kind)
+	assert.Equal(t, "first", first.Object.(types.Object).GetName())
+
+	_, err = otherKinds.Create(ctx, &OtherKind{TestKind: TestKind{ObjectMeta: objectMeta("second")}})
+	require.NoError(t, err)
+	second := <-events
+	assert.Equal(t, "OtherKind", second.Kind)
+	cancel()
+
+	// Resuming after the first event
+	feedCtx, cancel = context.WithCancel(ctx)
+	defer cancel()
+	events, err = f.Feed(feedCtx, FeedOptions{ResumeToken: first.ResumeToken})
+	require.NoError(t, err)
+	resumed := <-events
+	assert.Equal(t, "second", resumed.Object.(types.Object).GetName())
+	assert.Equal(t, second.ResumeToken, resumed.ResumeToken)
+
+	server := httptest.NewServer(f.FeedHandler())
+	defer server.Close()
+	resp, err := http.Get(server.URL + "?kind=testgroup/testversion/OtherKind&resumeToken=" + first.ResumeToken)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	require.NoError(t, err)
+	assert.Contains(t, line, `"kind":"OtherKind"`)
+	assert.Contains(t, line, `"name":"second"`)
+
+	_, err = f.Feed(ctx, FeedOptions{ResumeToken: "invalid"})
+	assert.True(t, apierrors.IsBadRequest(err))
+	invalid, err := http.Get(server.URL + "?resumeToken=invalid")
+	require.NoError(t, err)
+	invalid.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, invalid.StatusCode)
+
+	// Resuming from a token older than the compaction ends the feed with an expired error
+	_, err = testKinds.Create(ctx, &TestKind{ObjectMeta: objectMeta("third")})
+	require.NoError(t, err)
+	_, err = testKinds.(*Strategy).db.compact(ctx)
+	require.NoError(t, err)
+	events, err = f.Feed(ctx, FeedOptions{ResumeToken: first.ResumeToken})
+	require.NoError(t, err)
+	var last FeedEvent
+	for event := range events {
+		last = event
+	}
+	assert.Equal(t, watch.Error, last.Type)
+	assert.True(t, apierrors.IsResourceExpired(apierrors.FromObject(last.Object)))
+	assert.Empty(t, last.ResumeToken)
+
+	// A kind has one strategy until it is destroyed
+	cancel()
+	resp.Body.Close()
+	server.Close()
+	_, err = f.NewDBStrategy(&OtherKind{})
+	assert.Error(t, err)
+	otherKinds.Destroy()
+	if assert.Len(t, f.Kinds(), 1) {
+		assert.Equal(t, testGVK, f.Kinds()[0])
+	}
+
+	// Destroying a strategy leaves the pools of the Factory open for the others, and the kind can be created again
+	_, err = testKinds.List(ctx, "default", storage.ListOptions{})
+	require.NoError(t, err)
+	otherKinds, err = f.NewDBStrategy(&OtherKind{})
+	require.NoError(t, err)
+	_, err = otherKinds.List(ctx, "default", storage.ListOptions{})
+	require.NoError(t, err)
+	otherKinds.Destroy()
+}
+
+func TestExpire(t *testing.T) {
+	s := newStrategy(t)
+
+	create := func(name, expiresAt string, finalizers ...string) {
+		t.Helper()
+		_, err := s.Create(ctx, &TestKind{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   "default",
+				UID:         ktypes.UID(name + "uid"),
+				Annotations: map[string]string{types.ExpiresAtAnnotation: expiresAt},
+				Finalizers:  finalizers,
+			},
+		})
+		require.NoError(t, err)
+	}
+
+	past := time.Now().Add(-time.Minute).Format(time.RFC3339)
+	create("expired", past)
+	create("finalized", past, "test")
+	create("future", time.Now().Add(time.Hour).Format(time.RFC3339))
+
+	_, err := s.Create(ctx, &TestKind{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "invalid",
+			Namespace:   "default",
+			UID:         "invaliduid",
+			Annotations: map[string]string{types.ExpiresAtAnnotation: "tomorrow"},
+		},
+	})
+	assert.True(t, apierrors.IsBadRequest(err))
+
+	count, err := s.expire(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	_, err = s.Get(ctx, "default", "expired")
+	assert.True(t, apierrors.IsNotFound(err))
+
+	// Objects with finalizers are only marked for deletion, and not expired again
+	obj, err := s.Get(ctx, "default", "finalized")
+	require.NoError(t, err)
+	assert.NotNil(t, obj.GetDeletionTimestamp())
+
+	_, err = s.Get(ctx, "default", "future")
+	require.NoError(t, err)
+
+	count, err = s.expire(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+
+	// Expiry runs without compaction, in the process holding the lease of the table
+	background, err := NewWithOptions(ctx, s.db.sqlDB, testGVK, s.scheme, "strategytest", StrategyOptions{
+		DisableCompaction: true,
+		ExpiryInterval:    10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	defer background.cancelCompaction()
+	create("background", past)
+	assert.Eventually(t, func() bool {
+		_, err := s.Get(ctx, "default", "background")
+		return apierrors.IsNotFound(err)
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestCollectGarbage(t *testing.T) {
+	schema := runtime.NewScheme()
+	schema.AddKnownTypes(testGVK.GroupVersion(), &TestKind{}, &TestKindList{}, &OtherKind{}, &OtherKindList{})
+
+	f := newTestFactory(t, schema, FactoryOptions{
+		Strategy: StrategyOptions{
+			DisableCompaction: true,
+		},
+	})
+
+	owners, err := f.NewDBStrategy(&TestKind{})
+	require.NoError(t, err)
+	deleter := strategy.NewDelete(schema, owners)
+
+	// The Foreground and Orphan policies need a garbage collector
+	_, err = owners.Create(ctx, &TestKind{ObjectMeta: metav1.ObjectMeta{Name: "uncollected", Namespace: "default", UID: "uncollecteduid"}})
+	require.NoError(t, err)
+	_, _, err = deleter.Delete(genericapirequest.WithNamespace(ctx, "default"), "uncollected", nil, &metav1.DeleteOptions{
+		PropagationPolicy: &[]metav1.DeletionPropagation{metav1.DeletePropagationForeground}[0],
+	})
+	assert.True(t, apierrors.IsBadRequest(err))
+
+	gcCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		done <- f.CollectGarbage(gcCtx)
+	}()
+	assert.Eventually(t, f.GarbageCollected, 5*time.Second, 10*time.Millisecond)
+
+	// Kinds created once the garbage collector runs are collected too
+	dependents, err := f.NewDBStrategy(&OtherKind{})
+	require.NoError(t, err)
+
+	create := func(name string, finalizers ...string) types.Object {
+		t.Helper()
+		owner, err := owners.Create(ctx, &TestKind{ObjectMeta: metav1.ObjectMeta{
+			Name:       name,
+			Namespace:  "default",
+			UID:        ktypes.UID(name + "uid"),
+			Finalizers: finalizers,
+		}})
+		require.NoError(t, err)
+		_, err = dependents.Create(ctx, &OtherKind{TestKind: TestKind{ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			UID:       ktypes.UID(name + "dependentuid"),
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion:         testGVK.GroupVersion().String(),
+				Kind:               testGVK.Kind,
+				Name:               name,
+				UID:                owner.GetUID(),
+				BlockOwnerDeletion: &[]bool{true}[0],
+			}},
+		}}})
+		require.NoError(t, err)
+		return owner
+	}
+	remove := func(name string, policy metav1.DeletionPropagation) {
+		t.Helper()
+		_, _, err := deleter.Delete(genericapirequest.WithNamespace(ctx, "default"), name, nil, &metav1.DeleteOptions{
+			PropagationPolicy: &policy,
+		})
+		require.NoError(t, err)
+	}
+	gone := func(s strategy.CompleteStrategy, name string) func() bool {
+		return func() bool {
+			_, err := s.Get(ctx, "default", name)
+			return apierrors.IsNotFound(err)
+		}
+	}
+
+	create("background")
+	remove("background", metav1.DeletePropagationBackground)
+	assert.Eventually(t, gone(dependents, "background"), 5*time.Second, 10*time.Millisecond)
+
+	// The owner is only removed once the dependent is
+	create("foreground", "test")
+	remove("foreground", metav1.DeletePropagationForeground)
+	assert.Eventually(t, gone(dependents, "foreground"), 5*time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		owner, err := owners.Get(ctx, "default", "foreground")
+		require.NoError(t, err)
+		return slices.Equal(owner.GetFinalizers(), []string{"test"})
+	}, 5*time.Second, 10*time.Millisecond)
+
+	create("orphan")
+	remove("orphan", metav1.DeletePropagationOrphan)
+	assert.Eventually(t, gone(owners, "orphan"), 5*time.Second, 10*time.Millisecond)
+	dependent, err := dependents.Get(ctx, "default", "orphan")
+	require.NoError(t, err)
+	assert.Empty(t, dependent.GetOwnerReferences())
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+type GracefulKind struct {
+	TestKind
+}
+
+func (g *GracefulKind) DeepCopyObject() runtime.Object {
+	return &GracefulKind{
+		TestKind: *g.TestKind.DeepCopyObject().(*TestKind),
+	}
+}
+
+func (*GracefulKind) DefaultGracePeriodSeconds() int64 {
+	return 30
+}
+
+type GracefulKindList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []GracefulKind `json:"items"`
+}
+
+func (g *GracefulKindList) DeepCopyObject() runtime.Object {
+	return &GracefulKindList{}
+}
+
+func TestGracefulDelete(t *testing.T) {
+	schema := runtime.NewScheme()
+	schema.AddKnownTypes(testGVK.GroupVersion(), &GracefulKind{}, &GracefulKindList{})
+
+	f := newTestFactory(t, schema, FactoryOptions{
+		Strategy: StrategyOptions{
+			DisableCompaction: true,
+		},
+	})
+
+	cs, err := f.NewDBStrategy(&GracefulKind{})
+	require.NoError(t, err)
+	s := cs.(*Strategy)
+	deleter := strategy.NewDelete(schema, s)
+	deleteCtx := genericapirequest.WithNamespace(ctx, "default")
+
+	create := func(name string) {
+		t.Helper()
+		_, err := s.Create(ctx, &GracefulKind{TestKind: TestKind{ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			UID:       ktypes.UID(name + "uid"),
+		}}})
+		require.NoError(t, err)
+	}
+	remove := func(name string, gracePeriodSeconds *int64) (types.Object, bool) {
+		t.Helper()
+		obj, deleted, err := deleter.Delete(deleteCtx, name, nil, &metav1.DeleteOptions{
+			GracePeriodSeconds: gracePeriodSeconds,
+		})
+		require.NoError(t, err)
+		return obj.(types.Object), deleted
+	}
+	seconds := func(s int64) *int64 {
+		return &s
+	}
+
+	// The grace period defaults to the one of the kind, and the object stays until it ends
+	create("graceful")
+	obj, deleted := remove("graceful", nil)
+	assert.False(t, deleted)
+	assert.Equal(t, int64(30), *obj.GetDeletionGracePeriodSeconds())
+	obj, err = s.Get(ctx, "default", "graceful")
+	require.NoError(t, err)
+	deletionTimestamp := obj.GetDeletionTimestamp()
+	assert.True(t, deletionTimestamp.After(time.Now()))
+
+	// A longer grace period is ignored, a shorter one moves the deletion timestamp back
+	obj, _ = remove("graceful", seconds(60))
+	assert.Equal(t, int64(30), *obj.GetDeletionGracePeriodSeconds())
+	obj, _ = remove("graceful", seconds(10))
+	assert.Equal(t, int64(10), *obj.GetDeletionGracePeriodSeconds())
+	assert.True(t, obj.GetDeletionTimestamp().Before(deletionTimestamp))
+
+	count, err := s.expire(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+
+	// A zero grace period removes the object immediately
+	_, deleted = remove("graceful", seconds(0))
+	assert.True(t, deleted)
+	_, err = s.Get(ctx, "default", "graceful")
+	assert.True(t, apierrors.IsNotFound(err))
+
+	// Objects whose grace period ended are removed by the expiry
+	create("ended")
+	obj, err = s.Get(ctx, "default", "ended")
+	require.NoError(t, err)
+	past := metav1.NewTime(time.Now().Add(-time.Minute))
+	obj.SetDeletionTimestamp(&past)
+	obj.SetDeletionGracePeriodSeconds(seconds(1))
+	_, err = s.Delete(ctx, obj)
+	require.NoError(t, err)
+	_, err = s.Get(ctx, "default", "ended")
+	require.NoError(t, err)
+
+	count, err = s.expire(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	_, err = s.Get(ctx, "default", "ended")
+	assert.True(t, apierrors.IsNotFound(err))
+}
+
+func TestNamespaces(t *testing.T) {
+	schema := runtime.NewScheme()
+	schema.AddKnownTypes(testGVK.GroupVersion(), &TestKind{}, &TestKindList{}, &types.Namespace{}, &types.NamespaceList{})
+
+	f := newTestFactory(t, schema, FactoryOptions{
+		Strategy: StrategyOptions{
+			DisableCompaction: true,
+		},
+	})
+
+	testKinds, err := f.NewDBStrategy(&TestKind{})
+	require.NoError(t, err)
+	namespaces, err := f.NewNamespaceStrategy()
+	require.NoError(t, err)
+
+	createTestKind := func(namespace, name string) error {
+		_, err := strategy.NewCreate(schema, testKinds).Create(genericapirequest.WithNamespace(ctx, namespace), &TestKind{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+		}, nil, &metav1.CreateOptions{})
+		return err
+	}
+
+	assert.True(t, apierrors.IsNotFound(createTestKind("tenant", "missing")))
+
+	obj, err := strategy.NewCreate(schema, namespaces).Create(genericapirequest.WithNamespace(ctx, ""), &types.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "tenant"},
+	}, nil, &metav1.CreateOptions{})
+	require.NoError(t, err)
+	ns := obj.(*types.Namespace)
+	assert.Equal(t, types.NamespaceActive, ns.Status.Phase)
+	assert.Equal(t, []string{types.NamespaceFinalizer}, ns.Finalizers)
+
+	require.NoError(t, createTestKind("tenant", "first"))
+	require.NoError(t, createTestKind("tenant", "second"))
+
+	_, _, err = strategy.NewDelete(schema, namespaces).Delete(genericapirequest.WithNamespace(ctx, ""), "tenant", nil, nil)
+	require.NoError(t, err)
+	_, err = namespaces.Get(ctx, "", "tenant")
+	require.NoError(t, err)
+	assert.True(t, apierrors.IsForbidden(createTestKind("tenant", "third")))
+
+	// The namespace is checked again in the transaction of the create, it may be deleted after it was checked
+	_, err = testKinds.Create(ctx, &TestKind{ObjectMeta: metav1.ObjectMeta{Name: "checked", Namespace: "tenant", UID: "checkeduid"}})
+	assert.True(t, apierrors.IsForbidden(err))
+	_, err = testKinds.Create(ctx, &TestKind{ObjectMeta: metav1.ObjectMeta{Name: "checked", Namespace: "missing", UID: "checkeduid"}})
+	assert.True(t, apierrors.IsNotFound(err))
+
+	controllerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		done <- f.RunNamespaceController(controllerCtx)
+	}()
+
+	assert.Eventually(t, func() bool {
+		_, err := namespaces.Get(ctx, "", "tenant")
+		return apierrors.IsNotFound(err)
+	}, 5*time.Second, 10*time.Millisecond)
+	list, err := testKinds.List(ctx, "tenant", storage.ListOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, list.(*TestKindList).Items)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestQuotas(t *testing.T) {
+	schema := runtime.NewScheme()
+	schema.AddKnownTypes(testGVK.GroupVersion(), &TestKind{}, &TestKindList{}, &OtherKind{}, &OtherKindList{}, &types.QuotaUsage{}, &types.QuotaUsageList{})
+
+	limits := types.QuotaResources{
+		Objects: map[string]int64{"TestKind.testgroup": 2},
+		Bytes:   1000,
+	}
+	lateLimited := false
+	f := newTestFactory(t, schema, FactoryOptions{
+		Strategy: StrategyOptions{
+			DisableCompaction: true,
+		},
+		Quotas: func(_ context.Context, namespace string) (types.QuotaResources, error) {
+			if namespace == "limited" || (namespace == "late" && lateLimited) {
+				return limits, nil
+			}
+			return types.QuotaResources{}, nil
+		},
+	})
+
+	testKinds, err := f.NewDBStrategy(&TestKind{})
+	require.NoError(t, err)
+	otherKinds, err := f.NewDBStrategy(&OtherKind{})
+	require.NoError(t, err)
+	usages, err := f.NewQuotaUsageStrategy()
+	require.NoError(t, err)
+
+	objectMeta := func(namespace, name string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			UID:       ktypes.UID(namespace + name),
+		}
+	}
+
+	first, err := testKinds.Create(ctx, &TestKind{ObjectMeta: objectMeta("limited", "first")})
+	require.NoError(t, err)
+	_, err = testKinds.Create(ctx, &TestKind{ObjectMeta: objectMeta("limited", "second")})
+	require.NoError(t, err)
+	_, err = testKinds.Create(ctx, &TestKind{ObjectMeta: objectMeta("limited", "third")})
+	assert.True(t, apierrors.IsForbidden(err))
+
+	// Other namespaces are not limited
+	for i := range 3 {
+		_, err = testKinds.Create(ctx, &TestKind{ObjectMeta: objectMeta("unlimited", strconv.Itoa(i))})
+		require.NoError(t, err)
+	}
+
+	// Deleting an object frees its quota
+	_, err = testKinds.Delete(ctx, first)
+	require.NoError(t, err)
+	_, err = testKinds.Create(ctx, &TestKind{ObjectMeta: objectMeta("limited", "third")})
+	require.NoError(t, err)
+
+	// Bytes are limited across kinds
+	_, err = otherKinds.Create(ctx, &OtherKind{TestKind: TestKind{ObjectMeta: objectMeta("limited", "large"), Value: strings.Repeat("x", 500)}})
+	require.NoError(t, err)
+	_, err = otherKinds.Create(ctx, &OtherKind{TestKind: TestKind{ObjectMeta: objectMeta("limited", "larger"), Value: strings.Repeat("x", 500)}})
+	assert.True(t, apierrors.IsForbidden(err))
+
+	obj, err := usages.Get(ctx, "limited", types.QuotaUsageName)
+	require.NoError(t, err)
+	usage := obj.(*types.QuotaUsage)
+	assert.Equal(t, limits, usage.Status.Hard)
+	assert.Equal(t, map[string]int64{"TestKind.testgroup": 2, "OtherKind.testgroup": 1}, usage.Status.Used.Objects)
+	assert.Greater(t, usage.Status.Used.Bytes, int64(500))
+	assert.LessOrEqual(t, usage.Status.Used.Bytes, limits.Bytes)
+
+	// The usage of a namespace without limits is not tracked, but it is counted when it is read
+	for i := range 3 {
+		_, err = testKinds.Create(ctx, &TestKind{ObjectMeta: objectMeta("late", strconv.Itoa(i))})
+		require.NoError(t, err)
+	}
+	obj, err = usages.Get(ctx, "late", types.QuotaUsageName)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{"TestKind.testgroup": 3}, obj.(*types.QuotaUsage).Status.Used.Objects)
+
+	list, err := usages.List(ctx, "", storage.ListOptions{})
+	require.NoError(t, err)
+	assert.Len(t, list.(*types.QuotaUsageList).Items, 1)
+
+	// Once limits are set, the objects that already exist are counted by the next write
+	lateLimited = true
+	_, err = otherKinds.Create(ctx, &OtherKind{TestKind: TestKind{ObjectMeta: objectMeta("late", "other")}})
+	require.NoError(t, err)
+	_, err = testKinds.Create(ctx, &TestKind{ObjectMeta: objectMeta("late", "3")})
+	assert.True(t, apierrors.IsForbidden(err))
+
+	obj, err = usages.Get(ctx, "late", types.QuotaUsageName)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{"TestKind.testgroup": 3, "OtherKind.testgroup": 1}, obj.(*types.QuotaUsage).Status.Used.Objects)
+
+	list, err = usages.List(ctx, "", storage.ListOptions{})
+	require.NoError(t, err)
+	assert.Len(t, list.(*types.QuotaUsageList).Items, 2)
+
+	// Once limits are removed, the usage is not tracked anymore
+	lateLimited = false
+	_, err = testKinds.Create(ctx, &TestKind{ObjectMeta: objectMeta("late", "3")})
+	require.NoError(t, err)
+
+	list, err = usages.List(ctx, "", storage.ListOptions{})
+	require.NoError(t, err)
+	assert.Len(t, list.(*types.QuotaUsageList).Items, 1)
+}
+
+type StatusKind struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              string `json:"spec,omitempty"`
+	Status            string `json:"status,omitempty"`
+}
+
+func (s *StatusKind) DeepCopyObject() runtime.Object {
+	return &StatusKind{
+		TypeMeta:   s.TypeMeta,
+		ObjectMeta: *s.ObjectMeta.DeepCopy(),
+		Spec:       s.Spec,
+		Status:     s.Status,
+	}
+}
+
+func (s *StatusKind) ResetStatus(old runtime.Object) {
+	s.Status = old.(*StatusKind).Status
+}
+
+func (s *StatusKind) ResetSpec(old runtime.Object) {
+	status := s.Status
+	*s = *old.DeepCopyObject().(*StatusKind)
+	s.Status = status
+}
+
+type StatusKindList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []StatusKind `json:"items"`
+}
+
+func (s *StatusKindList) DeepCopyObject() runtime.Object {
+	return &StatusKindList{}
+}
+
+func TestGenerationSpecChanges(t *testing.T) {
+	schema := runtime.NewScheme()
+	schema.AddKnownTypes(testGVK.GroupVersion(), &StatusKind{}, &StatusKindList{})
+
+	db := newDatabase(t)
+	dropTable(t, db.sqlDB, "statuskind", db.stmt.Dialect())
+	s, err := New(ctx, db.sqlDB, testGVK.GroupVersion().WithKind("StatusKind"), schema, "statuskind")
+	require.NoError(t, err)
+
+	obj, err := s.Create(ctx, &StatusKind{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default", UID: "testuid"},
+		Spec:       "spec",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), obj.GetGeneration())
+
+	// Metadata and status changes keep the generation
+	obj.SetLabels(map[string]string{"key": "value"})
+	obj.(*StatusKind).Status = "status"
+	obj, err = s.Update(ctx, obj)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), obj.GetGeneration())
+
+	// The generation of the update is ignored
+	obj.SetGeneration(10)
+	obj, err = s.Update(ctx, obj)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), obj.GetGeneration())
+
+	obj.(*StatusKind).Spec = "new spec"
+	obj, err = s.Update(ctx, obj)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), obj.GetGeneration())
+
+	stored, err := s.Get(ctx, "default", "test")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stored.GetGeneration())
+}
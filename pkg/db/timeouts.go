@@ -0,0 +1,28 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// Timeouts bounds how long each kind of database operation may take. A zero value means no timeout. Reads and
+// writes are also bounded by the deadline of the request, if it is shorter.
+type Timeouts struct {
+	// Get is the timeout for reading a single object.
+	Get time.Duration
+	// List is the timeout for reading a page of a list or a watch.
+	List time.Duration
+	// Insert is the timeout for creating, updating or deleting an object.
+	Insert time.Duration
+	// Compaction is the timeout for one compaction of a table.
+	Compaction time.Duration
+	// Migration is the timeout for creating or migrating a table.
+	Migration time.Duration
+}
+
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,51 @@
+package db
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// watermarkTTL is how long the watermark of a table is reused by its lists and watches. Writes of the process
+// invalidate it when they commit, so only the writes of other processes can take that long to be listed.
+const watermarkTTL = 500 * time.Millisecond
+
+// watermarkCache shares the watermark of a table across its lists and watches, so that it is not read from the
+// database by every one of them.
+type watermarkCache struct {
+	// generation is incremented by every invalidation.
+	generation atomic.Uint64
+
+	lock sync.Mutex
+	// readGeneration is the generation the watermark was read at.
+	readGeneration uint64
+	read           time.Time
+	value          int64
+	ok             bool
+}
+
+// get returns the cached watermark, or reads it with read if it was invalidated or is older than watermarkTTL.
+func (c *watermarkCache) get(read func() (int64, bool, error)) (int64, bool, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	// The generation is loaded before reading, so a write that commits during the read invalidates its result.
+	generation := c.generation.Load()
+	if !c.read.IsZero() && c.readGeneration == generation && time.Since(c.read) < watermarkTTL {
+		return c.value, c.ok, nil
+	}
+
+	value, ok, err := read()
+	if err != nil {
+		return 0, false, err
+	}
+	c.readGeneration, c.read, c.value, c.ok = generation, time.Now(), value, ok
+	return value, ok, nil
+}
+
+// invalidate makes the next get read the watermark again. It is a no-op on a nil cache.
+func (c *watermarkCache) invalidate() {
+	if c != nil {
+		c.generation.Add(1)
+	}
+}
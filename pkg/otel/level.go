@@ -1,6 +1,9 @@
 package otel
 
-import "os"
+import (
+	"os"
+	"sync/atomic"
+)
 
 type Level string
 
@@ -16,7 +19,19 @@ func ParseLevel(v string) Level {
 	return Level(v).normalized()
 }
 
+var level atomic.Pointer[Level]
+
+// SetLevel sets the level of the spans started by StartSpanIfParent and StartSpanLevelIfParent. Until it is set, the
+// level is read from KINM_TRACE_LEVEL.
+func SetLevel(l Level) {
+	l = l.normalized()
+	level.Store(&l)
+}
+
 func CurrentLevel() Level {
+	if l := level.Load(); l != nil {
+		return *l
+	}
 	return ParseLevel(os.Getenv("KINM_TRACE_LEVEL"))
 }
 
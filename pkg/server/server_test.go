@@ -0,0 +1,378 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/obot-platform/kinm/pkg/apigroup"
+	"github.com/obot-platform/kinm/pkg/db"
+	"github.com/obot-platform/kinm/pkg/server"
+	"github.com/obot-platform/kinm/pkg/stores"
+	"github.com/obot-platform/kinm/pkg/strategy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apiextensionsopenapi "k8s.io/apiextensions-apiserver/pkg/generated/openapi"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizerfactory"
+	genericapiserver "k8s.io/apiserver/pkg/server"
+	"k8s.io/kube-openapi/pkg/common"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+)
+
+var widgetGV = schema.GroupVersion{Group: "example.com", Version: "v1"}
+
+type Widget struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   WidgetSpec   `json:"spec,omitempty"`
+	Status WidgetStatus `json:"status,omitempty"`
+}
+
+type WidgetSpec struct {
+	Size string `json:"size,omitempty"`
+	// Ports is a list of ports merged by their name.
+	Ports []WidgetPort `json:"ports,omitempty"`
+	// Labels is a map merged by key.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+type WidgetPort struct {
+	Name string `json:"name"`
+	Port int32  `json:"port,omitempty"`
+}
+
+type WidgetStatus struct {
+	Ready bool `json:"ready,omitempty"`
+}
+
+func (w *Widget) DeepCopyObject() runtime.Object {
+	result := &Widget{
+		TypeMeta:   w.TypeMeta,
+		ObjectMeta: *w.ObjectMeta.DeepCopy(),
+		Spec: WidgetSpec{
+			Size:  w.Spec.Size,
+			Ports: append([]WidgetPort(nil), w.Spec.Ports...),
+		},
+		Status: w.Status,
+	}
+	if w.Spec.Labels != nil {
+		result.Spec.Labels = make(map[string]string, len(w.Spec.Labels))
+		for k, v := range w.Spec.Labels {
+			result.Spec.Labels[k] = v
+		}
+	}
+	return result
+}
+
+func (w *Widget) ResetStatus(old runtime.Object) {
+	w.Status = old.(*Widget).Status
+}
+
+func (w *Widget) ResetSpec(old runtime.Object) {
+	status := w.Status
+	*w = *old.DeepCopyObject().(*Widget)
+	w.Status = status
+}
+
+type WidgetList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []Widget `json:"items"`
+}
+
+func (w *WidgetList) DeepCopyObject() runtime.Object {
+	result := &WidgetList{
+		TypeMeta: w.TypeMeta,
+		ListMeta: *w.ListMeta.DeepCopy(),
+	}
+	for _, item := range w.Items {
+		result.Items = append(result.Items, *item.DeepCopyObject().(*Widget))
+	}
+	return result
+}
+
+func (Widget) OpenAPIModelName() string       { return "com.example.v1.Widget" }
+func (WidgetList) OpenAPIModelName() string   { return "com.example.v1.WidgetList" }
+func (WidgetSpec) OpenAPIModelName() string   { return "com.example.v1.WidgetSpec" }
+func (WidgetPort) OpenAPIModelName() string   { return "com.example.v1.WidgetPort" }
+func (WidgetStatus) OpenAPIModelName() string { return "com.example.v1.WidgetStatus" }
+
+func addToScheme(scheme *runtime.Scheme) error {
+	scheme.AddKnownTypes(widgetGV, &Widget{}, &WidgetList{})
+	metav1.AddToGroupVersion(scheme, widgetGV)
+	metav1.AddToGroupVersion(scheme, schema.GroupVersion{Version: "v1"})
+	return nil
+}
+
+// openAPIDefinitions are the definitions of the widget kinds, and of the kinds of metav1 they refer to.
+func openAPIDefinitions(ref common.ReferenceCallback) map[string]common.OpenAPIDefinition {
+	var (
+		object = func(properties map[string]spec.Schema, required ...string) spec.Schema {
+			return spec.Schema{SchemaProps: spec.SchemaProps{Type: []string{"object"}, Properties: properties, Required: required}}
+		}
+		scalar = func(typ string) spec.Schema {
+			return spec.Schema{SchemaProps: spec.SchemaProps{Type: []string{typ}}}
+		}
+		refTo = func(name string) spec.Schema {
+			return spec.Schema{SchemaProps: spec.SchemaProps{Default: map[string]any{}, Ref: ref(name)}}
+		}
+		objectMeta = metav1.ObjectMeta{}.OpenAPIModelName()
+		listMeta   = metav1.ListMeta{}.OpenAPIModelName()
+	)
+
+	ports := spec.Schema{
+		SchemaProps: spec.SchemaProps{
+			Type: []string{"array"},
+			Items: &spec.SchemaOrArray{Schema: &spec.Schema{
+				SchemaProps: spec.SchemaProps{Default: map[string]any{}, Ref: ref(WidgetPort{}.OpenAPIModelName())},
+			}},
+		},
+		VendorExtensible: spec.VendorExtensible{Extensions: spec.Extensions{
+			"x-kubernetes-list-type":     "map",
+			"x-kubernetes-list-map-keys": []any{"name"},
+		}},
+	}
+	labels := spec.Schema{
+		SchemaProps: spec.SchemaProps{
+			Type:                 []string{"object"},
+			AdditionalProperties: &spec.SchemaOrBool{Allows: true, Schema: &spec.Schema{SchemaProps: spec.SchemaProps{Type: []string{"string"}}}},
+		},
+	}
+
+	result := apiextensionsopenapi.GetOpenAPIDefinitions(ref)
+	result[Widget{}.OpenAPIModelName()] = common.OpenAPIDefinition{
+		Schema: object(map[string]spec.Schema{
+			"apiVersion": scalar("string"),
+			"kind":       scalar("string"),
+			"metadata":   refTo(objectMeta),
+			"spec":       refTo(WidgetSpec{}.OpenAPIModelName()),
+			"status":     refTo(WidgetStatus{}.OpenAPIModelName()),
+		}),
+		Dependencies: []string{objectMeta, WidgetSpec{}.OpenAPIModelName(), WidgetStatus{}.OpenAPIModelName()},
+	}
+	result[WidgetList{}.OpenAPIModelName()] = common.OpenAPIDefinition{
+		Schema: object(map[string]spec.Schema{
+			"apiVersion": scalar("string"),
+			"kind":       scalar("string"),
+			"metadata":   refTo(listMeta),
+			"items": {SchemaProps: spec.SchemaProps{
+				Type:  []string{"array"},
+				Items: &spec.SchemaOrArray{Schema: &spec.Schema{SchemaProps: spec.SchemaProps{Default: map[string]any{}, Ref: ref(Widget{}.OpenAPIModelName())}}},
+			}},
+		}, "items"),
+		Dependencies: []string{listMeta, Widget{}.OpenAPIModelName()},
+	}
+	result[WidgetSpec{}.OpenAPIModelName()] = common.OpenAPIDefinition{
+		Schema: object(map[string]spec.Schema{
+			"size":   scalar("string"),
+			"ports":  ports,
+			"labels": labels,
+		}),
+		Dependencies: []string{WidgetPort{}.OpenAPIModelName()},
+	}
+	result[WidgetPort{}.OpenAPIModelName()] = common.OpenAPIDefinition{
+		Schema: object(map[string]spec.Schema{
+			"name": scalar("string"),
+			"port": scalar("integer"),
+		}, "name"),
+	}
+	result[WidgetStatus{}.OpenAPIModelName()] = common.OpenAPIDefinition{
+		Schema: object(map[string]spec.Schema{
+			"ready": scalar("boolean"),
+		}),
+	}
+	return result
+}
+
+// newTestServer serves the widgets of a database through a server, with the OpenAPI definitions of the widgets. The
+// storages of the widgets are returned by storages.
+func newTestServer(t *testing.T, storages func(scheme *runtime.Scheme, widgets strategy.CompleteStrategy) stores.Storages) *httptest.Server {
+	t.Helper()
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, addToScheme(scheme))
+
+	factory, err := db.NewFactory(scheme, "sqlite://"+filepath.Join(t.TempDir(), "kinm.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = factory.Close() })
+	widgets, err := factory.NewDBStrategy(&Widget{})
+	require.NoError(t, err)
+	t.Cleanup(widgets.Destroy)
+
+	apiGroup, err := apigroup.ForStores(addToScheme, storages(scheme, widgets), widgetGV)
+	require.NoError(t, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	opts := server.DefaultOpts()
+	opts.SecureServing.ServerCert.CertDirectory = t.TempDir()
+
+	srv, err := server.New(&server.Config{
+		Name:            "test",
+		Version:         "v0.0.0",
+		Listener:        listener,
+		HTTPSListenPort: listener.Addr().(*net.TCPAddr).Port,
+		Authenticator: authenticator.RequestFunc(func(*http.Request) (*authenticator.Response, bool, error) {
+			return &authenticator.Response{
+				User: &user.DefaultInfo{Name: "admin", Groups: []string{user.SystemPrivilegedGroup}},
+			}, true, nil
+		}),
+		Authorization:  authorizerfactory.NewAlwaysAllowAuthorizer(),
+		OpenAPIConfig:  openAPIDefinitions,
+		Scheme:         scheme,
+		APIGroups:      []*genericapiserver.APIGroupInfo{apiGroup},
+		DefaultOptions: opts,
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	httpServer := httptest.NewServer(srv.Handler(ctx))
+	t.Cleanup(httpServer.Close)
+	return httpServer
+}
+
+func TestServerSideApply(t *testing.T) {
+	httpServer := newTestServer(t, func(scheme *runtime.Scheme, widgets strategy.CompleteStrategy) stores.Storages {
+		return stores.NewCompleteWithStatus(scheme, "widgets", widgets)
+	})
+
+	apply := func(subresource, manager string, force bool, fields map[string]any) (*Widget, int) {
+		t.Helper()
+
+		fields["apiVersion"], fields["kind"] = widgetGV.String(), "Widget"
+		fields["metadata"] = map[string]any{"name": "test", "namespace": "default"}
+		body, err := json.Marshal(fields)
+		require.NoError(t, err)
+
+		url := fmt.Sprintf("%s/apis/%s/namespaces/default/widgets/test%s?fieldManager=%s&force=%t",
+			httpServer.URL, widgetGV, subresource, manager, force)
+		req, err := http.NewRequest(http.MethodPatch, url, bytes.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/apply-patch+yaml")
+
+		resp, err := httpServer.Client().Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		result := &Widget{}
+		if resp.StatusCode < http.StatusBadRequest {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(result))
+		}
+		return result, resp.StatusCode
+	}
+	managers := func(obj *Widget) (result []string) {
+		for _, entry := range obj.ManagedFields {
+			result = append(result, entry.Manager)
+		}
+		return
+	}
+	port := func(name string, port int32) map[string]any {
+		return map[string]any{"name": name, "port": port}
+	}
+	userConfig := func() map[string]any {
+		return map[string]any{"spec": map[string]any{
+			"size":   "small",
+			"ports":  []any{port("http", 80)},
+			"labels": map[string]any{"a": "1"},
+		}}
+	}
+
+	// An apply creates the object
+	obj, code := apply("", "user", false, userConfig())
+	require.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, WidgetSpec{Size: "small", Ports: []WidgetPort{{Name: "http", Port: 80}}, Labels: map[string]string{"a": "1"}}, obj.Spec)
+	assert.Equal(t, []string{"user"}, managers(obj))
+
+	// Applying the same configuration again writes nothing
+	again, code := apply("", "user", false, userConfig())
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, obj.ResourceVersion, again.ResourceVersion)
+
+	// The status is managed separately, it does not conflict with the spec
+	obj, code = apply("/status", "controller", false, map[string]any{"status": map[string]any{"ready": true}})
+	require.Equal(t, http.StatusOK, code)
+	assert.True(t, obj.Status.Ready)
+	assert.ElementsMatch(t, []string{"user", "controller"}, managers(obj))
+
+	// The items of a list with a merge key and the keys of a map are owned separately: another manager conflicts on
+	// the items and keys of the user, not on its own
+	_, code = apply("", "other", false, map[string]any{"spec": map[string]any{"ports": []any{port("http", 8080)}}})
+	assert.Equal(t, http.StatusConflict, code)
+	_, code = apply("", "other", false, map[string]any{"spec": map[string]any{"labels": map[string]any{"a": "2"}}})
+	assert.Equal(t, http.StatusConflict, code)
+
+	obj, code = apply("", "other", false, map[string]any{"spec": map[string]any{
+		"ports":  []any{port("https", 443)},
+		"labels": map[string]any{"b": "2"},
+	}})
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []WidgetPort{{Name: "http", Port: 80}, {Name: "https", Port: 443}}, obj.Spec.Ports)
+	assert.Equal(t, map[string]string{"a": "1", "b": "2"}, obj.Spec.Labels)
+
+	// A forced apply takes the conflicting fields from the user
+	obj, code = apply("", "other", true, map[string]any{"spec": map[string]any{
+		"ports":  []any{port("http", 8080), port("https", 443)},
+		"labels": map[string]any{"a": "2", "b": "2"},
+	}})
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []WidgetPort{{Name: "http", Port: 8080}, {Name: "https", Port: 443}}, obj.Spec.Ports)
+	assert.Equal(t, map[string]string{"a": "2", "b": "2"}, obj.Spec.Labels)
+
+	_, code = apply("", "user", false, userConfig())
+	assert.Equal(t, http.StatusConflict, code)
+
+	// Once the user stops applying the ports and labels, the fields of the other manager are kept, and so is the
+	// status
+	obj, code = apply("", "user", false, map[string]any{"spec": map[string]any{"size": "large"}})
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, WidgetSpec{
+		Size:   "large",
+		Ports:  []WidgetPort{{Name: "http", Port: 8080}, {Name: "https", Port: 443}},
+		Labels: map[string]string{"a": "2", "b": "2"},
+	}, obj.Spec)
+	assert.True(t, obj.Status.Ready)
+	assert.ElementsMatch(t, []string{"user", "controller", "other"}, managers(obj))
+}
+
+func TestBuilderStore(t *testing.T) {
+	httpServer := newTestServer(t, func(scheme *runtime.Scheme, widgets strategy.CompleteStrategy) stores.Storages {
+		return stores.NewBuilder(scheme, &Widget{}).WithCreate(widgets).WithGet(widgets).WithList(widgets).BuildResource("widgets")
+	})
+
+	do := func(method, resource, body string) int {
+		t.Helper()
+		req, err := http.NewRequest(method, fmt.Sprintf("%s/apis/%s/namespaces/default/%s", httpServer.URL, widgetGV, resource), strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := httpServer.Client().Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	widget := fmt.Sprintf(`{"apiVersion":%q,"kind":"Widget","metadata":{"name":"test"}}`, widgetGV)
+	assert.Equal(t, http.StatusCreated, do(http.MethodPost, "widgets", widget))
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "widgets", ""))
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "widgets/test", ""))
+
+	// The verbs that are not set are rejected
+	assert.Equal(t, http.StatusMethodNotAllowed, do(http.MethodPut, "widgets/test", widget))
+	assert.Equal(t, http.StatusMethodNotAllowed, do(http.MethodDelete, "widgets/test", ""))
+	assert.Equal(t, http.StatusMethodNotAllowed, do(http.MethodDelete, "widgets", ""))
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "widgets/test/status", ""))
+}
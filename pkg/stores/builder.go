@@ -1,27 +1,29 @@
 package stores
 
 import (
-	"fmt"
-
 	"github.com/obot-platform/kinm/pkg/strategy"
 	"github.com/obot-platform/kinm/pkg/types"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apiserver/pkg/registry/rest"
 	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 )
 
 type Builder struct {
 	scheme *runtime.Scheme
 	obj    kclient.Object
 
-	List           strategy.Lister
-	Update         strategy.Updater
-	Get            strategy.Getter
-	Create         strategy.Creater
-	Delete         strategy.Deleter
-	Destroy        strategy.Destroyer
-	Watch          strategy.Watcher
-	TableConverter rest.TableConvertor
+	List             strategy.Lister
+	Update           strategy.Updater
+	Patch            strategy.Updater
+	Get              strategy.Getter
+	Create           strategy.Creater
+	Delete           strategy.Deleter
+	DeleteCollection strategy.ListDeleter
+	Destroy          strategy.Destroyer
+	Watch            strategy.Watcher
+	UpdateStatus     strategy.StatusUpdater
+	TableConverter   rest.TableConvertor
 
 	PrepareForUpdater strategy.PrepareForUpdater
 	WarningsOnUpdater strategy.WarningsOnUpdater
@@ -31,8 +33,10 @@ type Builder struct {
 	WarningsOnCreator strategy.WarningsOnCreator
 	Validator         strategy.Validator
 	NameValidator     strategy.NameValidator
+	NamespaceChecker  strategy.NamespaceChecker
 
-	ValidateDeleter strategy.ValidateDeleter
+	ValidateDeleter          strategy.ValidateDeleter
+	GarbageCollectionChecker strategy.GarbageCollectionChecker
 }
 
 func NewBuilder(scheme *runtime.Scheme, obj kclient.Object) *Builder {
@@ -47,6 +51,11 @@ func (b Builder) WithWatch(watch strategy.Watcher) *Builder {
 	return &b
 }
 
+func (b Builder) WithUpdateStatus(status strategy.StatusUpdater) *Builder {
+	b.UpdateStatus = status
+	return &b
+}
+
 func (b Builder) WithTableConverter(table rest.TableConvertor) *Builder {
 	b.TableConverter = table
 	return &b
@@ -62,6 +71,12 @@ func (b Builder) WithUpdate(update strategy.Updater) *Builder {
 	return &b
 }
 
+// WithPatch serves patch requests, including server-side apply, with patch.
+func (b Builder) WithPatch(patch strategy.Updater) *Builder {
+	b.Patch = patch
+	return &b
+}
+
 func (b Builder) WithGet(get strategy.Getter) *Builder {
 	b.Get = get
 	return &b
@@ -73,7 +88,9 @@ func (b Builder) WithCompleteCRUD(complete strategy.CompleteCRUD) *Builder {
 		WithList(complete).
 		WithWatch(complete).
 		WithUpdate(complete).
-		WithDelete(complete)
+		WithPatch(complete).
+		WithDelete(complete).
+		WithDeleteCollection(complete)
 }
 
 func (b Builder) WithCreate(create strategy.Creater) *Builder {
@@ -116,6 +133,16 @@ func (b Builder) WithValidateName(validate strategy.NameValidator) *Builder {
 	return &b
 }
 
+func (b Builder) WithNamespaceChecker(checker strategy.NamespaceChecker) *Builder {
+	b.NamespaceChecker = checker
+	return &b
+}
+
+func (b Builder) WithGarbageCollectionChecker(checker strategy.GarbageCollectionChecker) *Builder {
+	b.GarbageCollectionChecker = checker
+	return &b
+}
+
 func (b Builder) WithWarnOnCreate(warn strategy.WarningsOnCreator) *Builder {
 	b.WarningsOnCreator = warn
 	return &b
@@ -126,202 +153,110 @@ func (b Builder) WithDelete(deleter strategy.Deleter) *Builder {
 	return &b
 }
 
+func (b Builder) WithDeleteCollection(deleter strategy.ListDeleter) *Builder {
+	b.DeleteCollection = deleter
+	return &b
+}
+
 func (b Builder) WithDestroy(destroy strategy.Destroyer) *Builder {
 	b.Destroy = destroy
 	return &b
 }
 
+// Build returns a store that serves the verbs of the strategies that are set. The status subresource is served by
+// the store of BuildResource.
 func (b Builder) Build() rest.Storage {
-	var (
-		getSet    = b.Get != nil
-		createSet = b.Create != nil
-		updateSet = b.Update != nil
-		listSet   = b.List != nil
-		deleteSet = b.Delete != nil
-		watchSet  = b.Watch != nil
-	)
-
-	if createSet && getSet && !listSet && !updateSet && !deleteSet && !watchSet {
-		return &CreateGetStore{
-			SingularNameAdapter: b.getSingularNameAdapter(),
-			CreateAdapter:       b.createAdapter(),
-			GetAdapter:          b.getAdapter(),
-			DestroyAdapter:      b.destroyAdapter(),
-			TableAdapter:        b.tableAdapter(),
-		}
+	if b.Create == nil && b.Get == nil && b.List == nil && b.Update == nil && b.Patch == nil && b.Delete == nil &&
+		b.DeleteCollection == nil && b.Watch == nil {
+		panic("at least one of create, get, list, update, patch, delete, deletecollection or watch must be set")
 	}
-	if createSet && getSet && listSet && !updateSet && deleteSet && !watchSet {
-		return &CreateGetListDeleteStore{
-			SingularNameAdapter: b.getSingularNameAdapter(),
-			GetAdapter:          b.getAdapter(),
-			CreateAdapter:       b.createAdapter(),
-			ListAdapter:         b.listAdapter(),
-			DeleteAdapter:       b.deleteAdapter(),
+
+	store := &Store{
+		storeBase: &storeBase{
+			NewAdapter:          b.newAdapter(),
 			DestroyAdapter:      b.destroyAdapter(),
-			TableAdapter:        b.tableAdapter(),
-		}
-	}
-	if createSet && !getSet && !listSet && !updateSet && !deleteSet && !watchSet {
-		return &CreateOnlyStore{
+			ScoperAdapter:       b.scoperAdapter(),
 			SingularNameAdapter: b.getSingularNameAdapter(),
-			CreateAdapter:       b.createAdapter(),
-			DestroyAdapter:      b.destroyAdapter(),
 			TableAdapter:        b.tableAdapter(),
-		}
+		},
+		lister: lister{newList: b.newList()},
 	}
-	if !createSet && getSet && listSet && !updateSet && !deleteSet && !watchSet {
-		return &GetListStore{
-			SingularNameAdapter: b.getSingularNameAdapter(),
-			GetAdapter:          b.getAdapter(),
-			ListAdapter:         b.listAdapter(),
-			DestroyAdapter:      b.destroyAdapter(),
-			NewAdapter:          b.newAdapter(),
-			TableAdapter:        b.tableAdapter(),
-		}
+	if b.Create != nil {
+		store.create = b.createAdapter()
 	}
-	if !createSet && getSet && listSet && !updateSet && deleteSet && !watchSet {
-		return &GetListDeleteStore{
-			SingularNameAdapter: b.getSingularNameAdapter(),
-			GetAdapter:          b.getAdapter(),
-			ListAdapter:         b.listAdapter(),
-			DeleteAdapter:       b.deleteAdapter(),
-			DestroyAdapter:      b.destroyAdapter(),
-			NewAdapter:          b.newAdapter(),
-			TableAdapter:        b.tableAdapter(),
-		}
+	if b.Get != nil {
+		store.get = b.getAdapter()
 	}
-	if !createSet && getSet && !listSet && !updateSet && !deleteSet && !watchSet {
-		return &GetOnlyStore{
-			SingularNameAdapter: b.getSingularNameAdapter(),
-			GetAdapter:          b.getAdapter(),
-			NewAdapter:          b.newAdapter(),
-			DestroyAdapter:      b.destroyAdapter(),
-			ScoperAdapter:       b.scoperAdapter(),
-			TableAdapter:        b.tableAdapter(),
-		}
+	if b.List != nil {
+		store.list = b.listAdapter()
 	}
-	if !createSet && !getSet && listSet && !updateSet && !deleteSet && !watchSet {
-		return &ListOnlyStore{
-			SingularNameAdapter: b.getSingularNameAdapter(),
-			ListAdapter:         b.listAdapter(),
-			DestroyAdapter:      b.destroyAdapter(),
-			NewAdapter:          b.newAdapter(),
-		}
+	if b.Update != nil {
+		store.update = b.updateAdapter(b.Update)
 	}
-	if !createSet && getSet && listSet && !updateSet && deleteSet && watchSet {
-		return &ReadDeleteStore{
-			SingularNameAdapter: b.getSingularNameAdapter(),
-			GetAdapter:          b.getAdapter(),
-			ListAdapter:         b.listAdapter(),
-			WatchAdapter:        b.watchAdapter(),
-			DeleteAdapter:       b.deleteAdapter(),
-			DestroyAdapter:      b.destroyAdapter(),
-			NewAdapter:          b.newAdapter(),
-		}
+	if b.Patch != nil {
+		store.patch = b.updateAdapter(b.Patch)
 	}
-	if createSet && getSet && listSet && updateSet && deleteSet && watchSet {
-		return &ReadWriteWatchStore{
-			SingularNameAdapter: b.getSingularNameAdapter(),
-			CreateAdapter:       b.createAdapter(),
-			GetAdapter:          b.getAdapter(),
-			ListAdapter:         b.listAdapter(),
-			UpdateAdapter:       b.updateAdapter(),
-			DeleteAdapter:       b.deleteAdapter(),
-			WatchAdapter:        b.watchAdapter(),
-			DestroyAdapter:      b.destroyAdapter(),
-			TableAdapter:        b.tableAdapter(),
-		}
+	if b.Delete != nil {
+		store.delete = b.deleteAdapter(b.Delete)
 	}
-	if createSet && getSet && listSet && !updateSet && deleteSet && watchSet {
-		return &CreateGetListDeleteWatchStore{
-			SingularNameAdapter: b.getSingularNameAdapter(),
-			CreateAdapter:       b.createAdapter(),
-			GetAdapter:          b.getAdapter(),
-			ListAdapter:         b.listAdapter(),
-			DeleteAdapter:       b.deleteAdapter(),
-			WatchAdapter:        b.watchAdapter(),
-			DestroyAdapter:      b.destroyAdapter(),
-			TableAdapter:        b.tableAdapter(),
-		}
+	if b.DeleteCollection != nil {
+		store.deleteCollection = b.deleteCollectionAdapter()
 	}
-	if createSet && getSet && listSet && updateSet && deleteSet && !watchSet {
-		return &CreateGetListDeleteUpdateStore{
-			SingularNameAdapter: b.getSingularNameAdapter(),
-			CreateAdapter:       b.createAdapter(),
-			GetAdapter:          b.getAdapter(),
-			ListAdapter:         b.listAdapter(),
-			DeleteAdapter:       b.deleteAdapter(),
-			UpdateAdapter:       b.updateAdapter(),
-			DestroyAdapter:      b.destroyAdapter(),
-			TableAdapter:        b.tableAdapter(),
-		}
+	if b.Watch != nil {
+		store.watch = b.watchAdapter()
 	}
-	if !createSet && getSet && listSet && updateSet && deleteSet && !watchSet {
-		return &GetListUpdateDeleteStore{
-			SingularNameAdapter: b.getSingularNameAdapter(),
-			GetAdapter:          b.getAdapter(),
-			ListAdapter:         b.listAdapter(),
-			UpdateAdapter:       b.updateAdapter(),
-			DeleteAdapter:       b.deleteAdapter(),
-			DestroyAdapter:      b.destroyAdapter(),
-			TableAdapter:        b.tableAdapter(),
-		}
+	return store
+}
+
+// BuildResource returns the storage of resource built by Build, and of its status subresource if UpdateStatus is set.
+func (b Builder) BuildResource(resource string) Storages {
+	result := Storages{
+		resource: b.Build(),
 	}
-	if !createSet && getSet && listSet && updateSet && deleteSet && watchSet {
-		return &GetListUpdateDeleteWatchStore{
-			SingularNameAdapter: b.getSingularNameAdapter(),
-			GetAdapter:          b.getAdapter(),
-			ListAdapter:         b.listAdapter(),
-			UpdateAdapter:       b.updateAdapter(),
-			DeleteAdapter:       b.deleteAdapter(),
-			WatchAdapter:        b.watchAdapter(),
-			DestroyAdapter:      b.destroyAdapter(),
-			TableAdapter:        b.tableAdapter(),
-		}
+	if b.UpdateStatus != nil {
+		result[resource+"/status"] = NewStatus(b.scheme, b.UpdateStatus)
 	}
-	if !createSet && !getSet && listSet && !updateSet && !deleteSet && watchSet {
-		return &ListWatchStore{
-			SingularNameAdapter: b.getSingularNameAdapter(),
-			NewAdapter:          b.newAdapter(),
-			ListAdapter:         b.listAdapter(),
-			WatchAdapter:        b.watchAdapter(),
-			DestroyAdapter:      b.destroyAdapter(),
-			TableAdapter:        b.tableAdapter(),
+	return result
+}
+
+// newList returns the lists of the list strategy, or else of the first strategy that has lists, or else of the list
+// kind of the object in the scheme.
+func (b Builder) newList() func() runtime.Object {
+	for _, s := range []any{b.List, b.DeleteCollection, b.Get, b.Create, b.Update, b.Patch, b.Delete, b.Watch} {
+		if lister, ok := s.(interface{ NewList() types.ObjectList }); ok {
+			return func() runtime.Object {
+				return lister.NewList()
+			}
 		}
 	}
-	if !createSet && getSet && listSet && !updateSet && !deleteSet && watchSet {
-		return &GetListWatchStore{
-			SingularNameAdapter: b.getSingularNameAdapter(),
-			NewAdapter:          b.newAdapter(),
-			GetAdapter:          b.getAdapter(),
-			ListAdapter:         b.listAdapter(),
-			WatchAdapter:        b.watchAdapter(),
-			DestroyAdapter:      b.destroyAdapter(),
-			TableAdapter:        b.tableAdapter(),
+	return func() runtime.Object {
+		gvk, err := apiutil.GVKForObject(b.obj, b.scheme)
+		if err != nil {
+			return nil
+		}
+		list, err := b.scheme.New(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		if err != nil {
+			return nil
 		}
+		return list
 	}
-	panic(fmt.Sprintf("createSet=%v, getSet=%v, listSet=%v, updateSet=%v, deleteSet=%v, watchSet=%v "+
-		"combination is not currently supported, PRs welcomed!", createSet, getSet, listSet, updateSet, deleteSet,
-		watchSet))
 }
 
 func (b Builder) watchAdapter() *strategy.WatchAdapter {
 	return strategy.NewWatch(b.Watch)
 }
 
-type newer struct {
-	obj kclient.Object
-}
-
-func (n *newer) New() types.Object {
-	return n.obj.DeepCopyObject().(types.Object)
-}
-
 func (b Builder) newAdapter() *strategy.NewAdapter {
 	return strategy.NewNew(&newer{obj: b.obj})
 }
 
+// scoperAdapter returns the scope of the first strategy that has one, or else of the object.
 func (b Builder) scoperAdapter() *strategy.ScoperAdapter {
+	for _, s := range []any{b.Create, b.Get, b.List, b.Update, b.Patch, b.Delete, b.DeleteCollection, b.Watch} {
+		if scoper, ok := s.(types.NamespaceScoper); ok {
+			return strategy.NewScoper(&newer{obj: b.obj, scoper: scoper})
+		}
+	}
 	return strategy.NewScoper(&newer{obj: b.obj})
 }
 
@@ -331,11 +266,12 @@ func (b Builder) createAdapter() *strategy.CreateAdapter {
 	create.Warner = b.WarningsOnCreator
 	create.Validator = b.Validator
 	create.NameValidator = b.NameValidator
+	create.NamespaceChecker = b.NamespaceChecker
 	return create
 }
 
-func (b Builder) updateAdapter() *strategy.UpdateAdapter {
-	update := strategy.NewUpdate(b.scheme, b.Update)
+func (b Builder) updateAdapter(updater strategy.Updater) *strategy.UpdateAdapter {
+	update := strategy.NewUpdate(b.scheme, updater)
 	update.PrepareForUpdater = b.PrepareForUpdater
 	update.WarningsOnUpdater = b.WarningsOnUpdater
 	update.ValidateUpdater = b.ValidateUpdater
@@ -357,16 +293,25 @@ func (b Builder) destroyAdapter() *strategy.DestroyAdapter {
 	return strategy.NewDestroyAdapter(b.Destroy)
 }
 
+// tableAdapter returns the TableConverter, or else the table of the list strategy.
 func (b Builder) tableAdapter() *strategy.TableAdapter {
-	return strategy.NewTable(b.TableConverter)
+	if b.TableConverter != nil {
+		return strategy.NewTable(b.TableConverter)
+	}
+	return strategy.NewTable(b.List)
 }
 
 func (b Builder) listAdapter() *strategy.ListAdapter {
 	return strategy.NewList(b.List)
 }
 
-func (b Builder) deleteAdapter() *strategy.DeleteAdapter {
-	deleter := strategy.NewDelete(b.scheme, b.Delete)
-	deleter.ValidateDeleter = b.ValidateDeleter
-	return deleter
+func (b Builder) deleteCollectionAdapter() *strategy.DeleteCollectionAdapter {
+	return strategy.NewDeleteCollection(b.deleteAdapter(b.DeleteCollection), strategy.NewList(b.DeleteCollection))
+}
+
+func (b Builder) deleteAdapter(deleter strategy.Deleter) *strategy.DeleteAdapter {
+	adapter := strategy.NewDelete(b.scheme, deleter)
+	adapter.ValidateDeleter = b.ValidateDeleter
+	adapter.GarbageCollectionChecker = b.GarbageCollectionChecker
+	return adapter
 }
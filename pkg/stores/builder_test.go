@@ -0,0 +1,92 @@
+package stores_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/obot-platform/kinm/pkg/stores"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/registry/rest"
+)
+
+func TestBuilderVerbs(t *testing.T) {
+	s, scheme := newStrategy(t)
+	builder := stores.NewBuilder(scheme, &StatusKind{})
+
+	_, err := s.Create(ctx, &StatusKind{ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default", UID: "testuid"}, Spec: "spec"})
+	require.NoError(t, err)
+
+	requestCtx := func(verb string) context.Context {
+		return genericapirequest.WithRequestInfo(genericapirequest.WithNamespace(ctx, "default"), &genericapirequest.RequestInfo{
+			Verb:     verb,
+			Resource: "statuskinds",
+		})
+	}
+	notSupported := func(err error) {
+		t.Helper()
+		assert.True(t, apierrors.IsMethodNotSupported(err), "expected a method not supported error, got %v", err)
+	}
+
+	// Create, get and watch, without list
+	store := builder.WithCreate(s).WithGet(s).WithWatch(s).Build()
+	assert.IsType(t, &stores.Store{}, store)
+	assert.True(t, store.(rest.Scoper).NamespaceScoped())
+
+	obj, err := store.(rest.Getter).Get(requestCtx("get"), "test", &metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "spec", obj.(*StatusKind).Spec)
+	watcher, err := store.(rest.Watcher).Watch(requestCtx("watch"), &metainternalversion.ListOptions{})
+	require.NoError(t, err)
+	watcher.Stop()
+
+	_, err = store.(rest.Lister).List(requestCtx("list"), &metainternalversion.ListOptions{})
+	notSupported(err)
+	_, _, err = store.(rest.Updater).Update(requestCtx("update"), "test", rest.DefaultUpdatedObjectInfo(obj), nil, nil, false, &metav1.UpdateOptions{})
+	notSupported(err)
+	_, _, err = store.(rest.GracefulDeleter).Delete(requestCtx("delete"), "test", nil, &metav1.DeleteOptions{})
+	notSupported(err)
+	_, err = store.(rest.CollectionDeleter).DeleteCollection(requestCtx("deletecollection"), nil, &metav1.DeleteOptions{}, &metainternalversion.ListOptions{})
+	notSupported(err)
+	// The apiserver creates a list of every store, even without list
+	assert.IsType(t, &StatusKindList{}, store.(rest.Lister).NewList())
+	assert.Nil(t, store.(rest.ResetFieldsFilterStrategy).GetResetFieldsFilter())
+
+	// Update and patch are independent
+	store = builder.WithUpdate(s).Build()
+	assert.NotNil(t, store.(rest.ResetFieldsFilterStrategy).GetResetFieldsFilter())
+	_, _, err = store.(rest.Updater).Update(requestCtx("patch"), "test", rest.DefaultUpdatedObjectInfo(obj), nil, nil, false, &metav1.UpdateOptions{})
+	notSupported(err)
+	_, _, err = store.(rest.Updater).Update(requestCtx("update"), "test", rest.DefaultUpdatedObjectInfo(obj), nil, nil, false, &metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	store = builder.WithPatch(s).Build()
+	_, _, err = store.(rest.Updater).Update(requestCtx("update"), "test", rest.DefaultUpdatedObjectInfo(obj), nil, nil, false, &metav1.UpdateOptions{})
+	notSupported(err)
+	_, _, err = store.(rest.Updater).Update(requestCtx("patch"), "test", rest.DefaultUpdatedObjectInfo(obj), nil, nil, false, &metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	// Delete and deletecollection are independent
+	store = builder.WithList(s).WithDelete(s).Build()
+	_, err = store.(rest.CollectionDeleter).DeleteCollection(requestCtx("deletecollection"), nil, &metav1.DeleteOptions{}, &metainternalversion.ListOptions{})
+	notSupported(err)
+	store = builder.WithDeleteCollection(s).Build()
+	_, _, err = store.(rest.GracefulDeleter).Delete(requestCtx("delete"), "test", nil, &metav1.DeleteOptions{})
+	notSupported(err)
+	deleted, err := store.(rest.CollectionDeleter).DeleteCollection(requestCtx("deletecollection"), nil, &metav1.DeleteOptions{}, &metainternalversion.ListOptions{})
+	require.NoError(t, err)
+	assert.Len(t, deleted.(*StatusKindList).Items, 1)
+
+	// Status is served by a subresource
+	storage := builder.WithGet(s).BuildResource("statuskinds")
+	assert.Len(t, storage, 1)
+	storage = builder.WithGet(s).WithUpdateStatus(s).BuildResource("statuskinds")
+	assert.Implements(t, (*rest.Getter)(nil), storage["statuskinds"])
+	assert.Implements(t, (*rest.Updater)(nil), storage["statuskinds/status"])
+
+	assert.Panics(t, func() { builder.Build() })
+}
@@ -7,7 +7,8 @@ import (
 )
 
 var (
-	_ strategy.Base = (*Complete)(nil)
+	_ strategy.Base          = (*Complete)(nil)
+	_ rest.CollectionDeleter = (*Complete)(nil)
 )
 
 func NewComplete(scheme *runtime.Scheme, s strategy.CompleteStrategy) rest.Storage {
@@ -15,6 +16,15 @@ func NewComplete(scheme *runtime.Scheme, s strategy.CompleteStrategy) rest.Stora
 	return store
 }
 
+// NewCompleteWithStatus returns the storages of resource and of its status subresource.
+func NewCompleteWithStatus(scheme *runtime.Scheme, resource string, s strategy.CompleteStrategy) Storages {
+	store, status := newComplete(scheme, s)
+	return Storages{
+		resource:             store,
+		resource + "/status": status,
+	}
+}
+
 type Complete struct {
 	*strategy.SingularNameAdapter
 	*strategy.CreateAdapter
@@ -22,6 +32,7 @@ type Complete struct {
 	*strategy.GetAdapter
 	*strategy.ListAdapter
 	*strategy.DeleteAdapter
+	*strategy.DeleteCollectionAdapter
 	*strategy.WatchAdapter
 
 	strategy strategy.CompleteStrategy
@@ -36,14 +47,19 @@ func (c *Complete) Destroy() {
 }
 
 func newComplete(scheme *runtime.Scheme, s strategy.CompleteStrategy) (*Complete, *strategy.Status) {
+	var (
+		listAdapter   = strategy.NewList(s)
+		deleteAdapter = strategy.NewDelete(scheme, s)
+	)
 	return &Complete{
-		SingularNameAdapter: strategy.NewSingularNameAdapter(s.New(), scheme),
-		CreateAdapter:       strategy.NewCreate(scheme, s),
-		UpdateAdapter:       strategy.NewUpdate(scheme, s),
-		GetAdapter:          strategy.NewGet(s),
-		ListAdapter:         strategy.NewList(s),
-		DeleteAdapter:       strategy.NewDelete(scheme, s),
-		WatchAdapter:        strategy.NewWatch(s),
-		strategy:            s,
+		SingularNameAdapter:     strategy.NewSingularNameAdapter(s.New(), scheme),
+		CreateAdapter:           strategy.NewCreate(scheme, s),
+		UpdateAdapter:           strategy.NewUpdate(scheme, s),
+		GetAdapter:              strategy.NewGet(s),
+		ListAdapter:             listAdapter,
+		DeleteAdapter:           deleteAdapter,
+		DeleteCollectionAdapter: strategy.NewDeleteCollection(deleteAdapter, listAdapter),
+		WatchAdapter:            strategy.NewWatch(s),
+		strategy:                s,
 	}, strategy.NewStatus(scheme, s)
 }
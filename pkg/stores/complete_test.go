@@ -0,0 +1,24 @@
+package stores_test
+
+import (
+	"testing"
+
+	"github.com/obot-platform/kinm/pkg/stores"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apiserver/pkg/registry/rest"
+)
+
+func TestCompleteWithStatus(t *testing.T) {
+	s, scheme := newStrategy(t)
+	storages := stores.NewCompleteWithStatus(scheme, "statuskinds", s)
+	require.Len(t, storages, 2)
+	assert.Implements(t, (*rest.CollectionDeleter)(nil), storages["statuskinds"])
+	assert.Implements(t, (*rest.Updater)(nil), storages["statuskinds/status"])
+
+	// The storages of several resources are served together
+	all := storages.With(stores.NewCompleteWithStatus(scheme, "otherkinds", s))
+	assert.Len(t, all, 4)
+	assert.Contains(t, all, "otherkinds/status")
+	assert.Len(t, storages, 2)
+}
@@ -1,32 +0,0 @@
-package stores
-
-import (
-	"github.com/obot-platform/kinm/pkg/strategy"
-	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apiserver/pkg/registry/rest"
-)
-
-var (
-	_ rest.Getter             = (*CreateGetListDeleteStore)(nil)
-	_ rest.Lister             = (*CreateGetListDeleteStore)(nil)
-	_ rest.RESTDeleteStrategy = (*CreateGetListDeleteStore)(nil)
-	_ strategy.Base           = (*CreateGetListDeleteStore)(nil)
-)
-
-type CreateGetListDeleteStore struct {
-	*strategy.SingularNameAdapter
-	*strategy.GetAdapter
-	*strategy.CreateAdapter
-	*strategy.ListAdapter
-	*strategy.DeleteAdapter
-	*strategy.DestroyAdapter
-	*strategy.TableAdapter
-}
-
-func (c *CreateGetListDeleteStore) New() runtime.Object {
-	return c.CreateAdapter.New()
-}
-
-func (r *CreateGetListDeleteStore) NamespaceScoped() bool {
-	return r.ListAdapter.NamespaceScoped()
-}
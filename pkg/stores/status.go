@@ -8,6 +8,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apiserver/pkg/registry/rest"
+	"sigs.k8s.io/structured-merge-diff/v6/fieldpath"
 )
 
 type Status struct {
@@ -41,6 +42,10 @@ func (s *Status) Update(ctx context.Context, name string, objInfo rest.UpdatedOb
 	return s.update.Update(ctx, name, objInfo, createValidation, updateValidation, false, options)
 }
 
+func (s *Status) GetResetFieldsFilter() map[fieldpath.APIVersion]fieldpath.Filter {
+	return s.update.GetResetFieldsFilter()
+}
+
 func (s *Status) ConvertToTable(ctx context.Context, object runtime.Object, tableOptions runtime.Object) (*metav1.Table, error) {
 	if o, ok := s.strategy.(rest.TableConvertor); ok {
 		return o.ConvertToTable(ctx, object, tableOptions)
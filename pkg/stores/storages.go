@@ -0,0 +1,24 @@
+package stores
+
+import (
+	"maps"
+
+	"k8s.io/apiserver/pkg/registry/rest"
+)
+
+// Storages are the stores of an API group by resource, as passed to apigroup.ForStores. Subresources are keyed by
+// "<resource>/<subresource>".
+type Storages map[string]rest.Storage
+
+// With returns a copy of s with the entries of storages added, for instance to serve the storages of several
+// NewCompleteWithStatus.
+func (s Storages) With(storages ...Storages) Storages {
+	result := maps.Clone(s)
+	if result == nil {
+		result = Storages{}
+	}
+	for _, storage := range storages {
+		maps.Copy(result, storage)
+	}
+	return result
+}
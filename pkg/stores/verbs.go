@@ -0,0 +1,204 @@
+package stores
+
+import (
+	"context"
+
+	"github.com/obot-platform/kinm/pkg/strategy"
+	"github.com/obot-platform/kinm/pkg/types"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/registry/rest"
+	kclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/structured-merge-diff/v6/fieldpath"
+)
+
+var (
+	_ strategy.Base                  = (*Store)(nil)
+	_ rest.Creater                   = (*Store)(nil)
+	_ rest.Getter                    = (*Store)(nil)
+	_ rest.Lister                    = (*Store)(nil)
+	_ rest.Updater                   = (*Store)(nil)
+	_ rest.Patcher                   = (*Store)(nil)
+	_ rest.ResetFieldsFilterStrategy = (*Store)(nil)
+	_ rest.GracefulDeleter           = (*Store)(nil)
+	_ rest.CollectionDeleter         = (*Store)(nil)
+	_ rest.Watcher                   = (*Store)(nil)
+)
+
+// Store serves the verbs of the adapters that are set, see Builder.Build. It implements the rest interface of every
+// verb, so the apiserver routes every verb to it, and the requests of a verb whose adapter is not set are rejected as
+// not supported.
+type Store struct {
+	*storeBase
+	creater
+	getter
+	lister
+	updater
+	deleter
+	collectionDeleter
+	watcher
+}
+
+// The stores that Builder.Build returned for some combinations of verbs, before it returned a Store for all of them.
+//
+// Deprecated: use Store.
+type (
+	CreateGetStore                 = Store
+	CreateGetListDeleteStore       = Store
+	CreateGetListDeleteUpdateStore = Store
+	CreateGetListDeleteWatchStore  = Store
+	CreateOnlyStore                = Store
+	GetListStore                   = Store
+	GetListDeleteStore             = Store
+	GetListUpdateDeleteStore       = Store
+	GetListUpdateDeleteWatchStore  = Store
+	GetListWatchStore              = Store
+	GetOnlyStore                   = Store
+	ListOnlyStore                  = Store
+	ListWatchStore                 = Store
+	ReadDeleteStore                = Store
+	ReadWriteWatchStore            = Store
+)
+
+// storeBase provides the methods of rest.Storage and strategy.Base.
+type storeBase struct {
+	*strategy.NewAdapter
+	*strategy.DestroyAdapter
+	*strategy.ScoperAdapter
+	*strategy.SingularNameAdapter
+	*strategy.TableAdapter
+}
+
+// notSupported returns the error of a request of verb to a store that does not serve it.
+func notSupported(ctx context.Context, verb string) error {
+	var resource schema.GroupResource
+	if info, ok := genericapirequest.RequestInfoFrom(ctx); ok {
+		resource = schema.GroupResource{Group: info.APIGroup, Resource: info.Resource}
+	}
+	return apierrors.NewMethodNotSupported(resource, verb)
+}
+
+type creater struct {
+	create *strategy.CreateAdapter
+}
+
+func (c creater) Create(ctx context.Context, obj runtime.Object, createValidation rest.ValidateObjectFunc, options *metav1.CreateOptions) (runtime.Object, error) {
+	if c.create == nil {
+		return nil, notSupported(ctx, "create")
+	}
+	return c.create.Create(ctx, obj, createValidation, options)
+}
+
+type getter struct {
+	get *strategy.GetAdapter
+}
+
+func (g getter) Get(ctx context.Context, name string, options *metav1.GetOptions) (runtime.Object, error) {
+	if g.get == nil {
+		return nil, notSupported(ctx, "get")
+	}
+	return g.get.Get(ctx, name, options)
+}
+
+// lister serves list requests. The apiserver creates a list of every store when it is installed, so newList is set
+// even if list is not.
+type lister struct {
+	list    *strategy.ListAdapter
+	newList func() runtime.Object
+}
+
+func (l lister) List(ctx context.Context, options *metainternalversion.ListOptions) (runtime.Object, error) {
+	if l.list == nil {
+		return nil, notSupported(ctx, "list")
+	}
+	return l.list.List(ctx, options)
+}
+
+func (l lister) NewList() runtime.Object {
+	return l.newList()
+}
+
+// updater serves the update and patch requests, which the apiserver both sends to Update.
+type updater struct {
+	update *strategy.UpdateAdapter
+	patch  *strategy.UpdateAdapter
+}
+
+func (u updater) Update(ctx context.Context, name string, objInfo rest.UpdatedObjectInfo, createValidation rest.ValidateObjectFunc, updateValidation rest.ValidateObjectUpdateFunc, forceAllowCreate bool, options *metav1.UpdateOptions) (runtime.Object, bool, error) {
+	update, verb := u.update, "update"
+	if info, ok := genericapirequest.RequestInfoFrom(ctx); ok && info.Verb == "patch" {
+		update, verb = u.patch, "patch"
+	}
+	if update == nil {
+		return nil, false, notSupported(ctx, verb)
+	}
+	return update.Update(ctx, name, objInfo, createValidation, updateValidation, forceAllowCreate, options)
+}
+
+func (u updater) GetResetFieldsFilter() map[fieldpath.APIVersion]fieldpath.Filter {
+	switch {
+	case u.update != nil:
+		return u.update.GetResetFieldsFilter()
+	case u.patch != nil:
+		return u.patch.GetResetFieldsFilter()
+	}
+	return nil
+}
+
+type deleter struct {
+	delete *strategy.DeleteAdapter
+}
+
+func (d deleter) Delete(ctx context.Context, name string, deleteValidation rest.ValidateObjectFunc, options *metav1.DeleteOptions) (runtime.Object, bool, error) {
+	if d.delete == nil {
+		return nil, false, notSupported(ctx, "delete")
+	}
+	return d.delete.Delete(ctx, name, deleteValidation, options)
+}
+
+type collectionDeleter struct {
+	deleteCollection *strategy.DeleteCollectionAdapter
+}
+
+func (c collectionDeleter) DeleteCollection(ctx context.Context, deleteValidation rest.ValidateObjectFunc, options *metav1.DeleteOptions, listOptions *metainternalversion.ListOptions) (runtime.Object, error) {
+	if c.deleteCollection == nil {
+		return nil, notSupported(ctx, "deletecollection")
+	}
+	return c.deleteCollection.DeleteCollection(ctx, deleteValidation, options, listOptions)
+}
+
+type watcher struct {
+	watch *strategy.WatchAdapter
+}
+
+func (w watcher) Watch(ctx context.Context, options *metainternalversion.ListOptions) (watch.Interface, error) {
+	if w.watch == nil {
+		return nil, notSupported(ctx, "watch")
+	}
+	return w.watch.Watch(ctx, options)
+}
+
+// newer creates copies of obj. It is namespace scoped if scoper is, or else if obj is.
+type newer struct {
+	obj    kclient.Object
+	scoper types.NamespaceScoper
+}
+
+func (n *newer) New() types.Object {
+	return n.obj.DeepCopyObject().(types.Object)
+}
+
+func (n *newer) NamespaceScoped() bool {
+	if n.scoper != nil {
+		return n.scoper.NamespaceScoped()
+	}
+	if o, ok := n.obj.(types.NamespaceScoper); ok {
+		return o.NamespaceScoped()
+	}
+	return true
+}
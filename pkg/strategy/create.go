@@ -46,11 +46,27 @@ type PrepareForCreator interface {
 	PrepareForCreate(ctx context.Context, obj runtime.Object)
 }
 
+// NamespaceChecker admits the creates of namespaced objects, it returns an error if objects can't be created in the
+// namespace, for instance because it does not exist or is being deleted.
+type NamespaceChecker interface {
+	CheckNamespace(ctx context.Context, namespace string) error
+}
+
+// GenerateNameRetryLimiter returns how many times a create is retried with a new name if the name generated from
+// metadata.generateName is taken.
+type GenerateNameRetryLimiter interface {
+	GenerateNameRetryLimit() int
+}
+
 var _ rest.Creater = (*CreateAdapter)(nil)
 
+// NewCreate returns a CreateAdapter for strategy. If strategy is not a GenerateNameRetryLimiter, creates with a
+// generated name are retried KINM_GENERATE_NAME_COLLISION_RETRY_LIMIT times, or 5 times if it is not set.
 func NewCreate(schema *runtime.Scheme, strategy Creater) *CreateAdapter {
 	generateNameCollisionRetryLimit := 5
-	if newLimit := os.Getenv("KINM_GENERATE_NAME_COLLISION_RETRY_LIMIT"); newLimit != "" {
+	if o, ok := strategy.(GenerateNameRetryLimiter); ok {
+		generateNameCollisionRetryLimit = o.GenerateNameRetryLimit()
+	} else if newLimit := os.Getenv("KINM_GENERATE_NAME_COLLISION_RETRY_LIMIT"); newLimit != "" {
 		if limit, err := strconv.Atoi(newLimit); err == nil {
 			generateNameCollisionRetryLimit = limit
 		}
@@ -71,6 +87,7 @@ type CreateAdapter struct {
 	Validator              Validator
 	NameValidator          NameValidator
 	PrepareForCreater      PrepareForCreator
+	NamespaceChecker       NamespaceChecker
 	generateNameRetryLimit int
 }
 
@@ -114,6 +131,10 @@ func (a *CreateAdapter) Create(ctx context.Context, obj runtime.Object, createVa
 			}
 		}
 
+		if err := a.checkNamespace(ctx, obj); err != nil {
+			return nil, err
+		}
+
 		if len(options.DryRun) != 0 && options.DryRun[0] == metav1.DryRunAll {
 			return obj, nil
 		}
@@ -137,6 +158,19 @@ func (a *CreateAdapter) PrepareForCreate(ctx context.Context, obj runtime.Object
 	}
 }
 
+func (a *CreateAdapter) checkNamespace(ctx context.Context, obj runtime.Object) error {
+	if !a.NamespaceScoped() {
+		return nil
+	}
+	namespace := obj.(types.Object).GetNamespace()
+	if a.NamespaceChecker != nil {
+		return a.NamespaceChecker.CheckNamespace(ctx, namespace)
+	} else if o, ok := a.strategy.(NamespaceChecker); ok {
+		return o.CheckNamespace(ctx, namespace)
+	}
+	return nil
+}
+
 func checkNamespace(nsed bool, obj runtime.Object) *field.Error {
 	o := obj.(types.Object)
 	if nsed && o.GetNamespace() == "" {
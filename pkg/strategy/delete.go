@@ -2,6 +2,8 @@ package strategy
 
 import (
 	"context"
+	"fmt"
+	"slices"
 
 	"github.com/obot-platform/kinm/pkg/types"
 	apierror "k8s.io/apimachinery/pkg/api/errors"
@@ -17,13 +19,22 @@ type ValidateDeleter interface {
 	ValidateDelete(ctx context.Context, obj runtime.Object) *apierror.StatusError
 }
 
+// GarbageCollectionChecker returns true if a garbage collector runs for the objects of a strategy, which removes the
+// finalizers of the objects deleted with the Foreground or Orphan propagation policy.
+type GarbageCollectionChecker interface {
+	GarbageCollected() bool
+}
+
 type Deleter interface {
 	Getter
 
 	Delete(ctx context.Context, obj types.Object) (types.Object, error)
 }
 
-var _ rest.GracefulDeleter = (*DeleteAdapter)(nil)
+var (
+	_ rest.GracefulDeleter            = (*DeleteAdapter)(nil)
+	_ rest.RESTGracefulDeleteStrategy = (*DeleteAdapter)(nil)
+)
 
 func NewDelete(scheme *runtime.Scheme, strategy Deleter) *DeleteAdapter {
 	return &DeleteAdapter{
@@ -36,6 +47,9 @@ type DeleteAdapter struct {
 	scheme          *runtime.Scheme
 	strategy        Deleter
 	ValidateDeleter ValidateDeleter
+	// GarbageCollectionChecker rejects the Foreground and Orphan propagation policies while no garbage collector
+	// runs. If nil, the strategy is used if it is a GarbageCollectionChecker, otherwise the policies are rejected.
+	GarbageCollectionChecker GarbageCollectionChecker
 }
 
 func (a *DeleteAdapter) ObjectKinds(obj runtime.Object) ([]schema.GroupVersionKind, bool, error) {
@@ -57,44 +71,130 @@ func (a *DeleteAdapter) Delete(ctx context.Context, name string, deleteValidatio
 	if options == nil {
 		options = metav1.NewDeleteOptions(0)
 	}
+
+	if ok, err := a.prepareDelete(ctx, obj, deleteValidation, options); err != nil {
+		return nil, false, err
+	} else if !ok {
+		return obj, false, nil
+	}
+
+	if len(options.DryRun) != 0 && options.DryRun[0] == metav1.DryRunAll {
+		return obj, false, nil
+	}
+
+	// A grace period shortened to zero deletes the object immediately as well
+	period := obj.GetDeletionGracePeriodSeconds()
+	newObj, err := a.strategy.Delete(ctx, obj)
+	return newObj, period == nil || *period == 0, err
+}
+
+// prepareDelete validates the delete of obj and sets its deletion timestamp, grace period and the finalizers of the
+// propagation policy of options. It returns false if obj is not deleted again, because it is already being deleted.
+func (a *DeleteAdapter) prepareDelete(ctx context.Context, obj types.Object, deleteValidation rest.ValidateObjectFunc, options *metav1.DeleteOptions) (bool, error) {
 	var preconditions storage.Preconditions
 	if options.Preconditions != nil {
 		preconditions.UID = options.Preconditions.UID
 		preconditions.ResourceVersion = options.Preconditions.ResourceVersion
-		if err := preconditions.Check(name, obj); err != nil {
-			return nil, false, err
+		if err := preconditions.Check(obj.GetName(), obj); err != nil {
+			return false, err
 		}
 	}
 
 	if deleteValidation != nil {
-		err = deleteValidation(ctx, obj)
-		if err != nil {
-			return nil, false, err
+		if err := deleteValidation(ctx, obj); err != nil {
+			return false, err
 		}
 	}
 
-	_, _, err = rest.BeforeDelete(a, ctx, obj, options)
+	deleting := !obj.GetDeletionTimestamp().IsZero()
+	graceful, pending, err := rest.BeforeDelete(a, ctx, obj, options)
 	if err != nil {
-		return nil, false, err
+		return false, err
 	}
 
-	if !obj.GetDeletionTimestamp().IsZero() {
-		return obj, false, nil
+	// An object that is being deleted is only deleted again to shorten its grace period
+	if pending || (deleting && !graceful) {
+		return false, nil
 	}
 
-	if a.ValidateDeleter != nil {
-		if err := a.ValidateDeleter.ValidateDelete(ctx, obj); err != nil {
-			return nil, false, err
+	if !deleting {
+		if a.ValidateDeleter != nil {
+			if err := a.ValidateDeleter.ValidateDelete(ctx, obj); err != nil {
+				return false, err
+			}
+		}
+
+		if err := addPropagationFinalizer(obj, options, a.garbageCollected()); err != nil {
+			return false, err
 		}
 	}
 
-	now := metav1.Now()
-	obj.SetDeletionTimestamp(&now)
+	// The deletion timestamp of a graceful delete is set by BeforeDelete, at the end of the grace period
+	if !graceful {
+		now := metav1.Now()
+		obj.SetDeletionTimestamp(&now)
+	}
+	return true, nil
+}
 
-	if len(options.DryRun) != 0 && options.DryRun[0] == metav1.DryRunAll {
-		return obj, false, nil
+// garbageCollected returns true if a garbage collector runs for the objects of the strategy.
+func (a *DeleteAdapter) garbageCollected() bool {
+	if a.GarbageCollectionChecker != nil {
+		return a.GarbageCollectionChecker.GarbageCollected()
+	} else if o, ok := a.strategy.(GarbageCollectionChecker); ok {
+		return o.GarbageCollected()
 	}
+	return false
+}
 
-	newObj, err := a.strategy.Delete(ctx, obj)
-	return newObj, true, err
+// CheckGracefulDelete defaults the grace period of options for objects that implement types.GracefulDeleter, and
+// returns true if they are deleted gracefully.
+func (a *DeleteAdapter) CheckGracefulDelete(_ context.Context, obj runtime.Object, options *metav1.DeleteOptions) bool {
+	o, ok := obj.(types.GracefulDeleter)
+	if !ok {
+		return false
+	}
+	if options.GracePeriodSeconds == nil {
+		period := o.DefaultGracePeriodSeconds()
+		options.GracePeriodSeconds = &period
+	}
+	return *options.GracePeriodSeconds > 0
+}
+
+// addPropagationFinalizer adds the finalizer of the propagation policy of options to obj, which the garbage
+// collector removes once it handled the dependents of obj. The Foreground and Orphan policies are rejected unless
+// collected is true, objects deleted with them would never be removed.
+func addPropagationFinalizer(obj types.Object, options *metav1.DeleteOptions, collected bool) error {
+	policy := options.PropagationPolicy
+	if options.OrphanDependents != nil {
+		if policy != nil {
+			return apierror.NewBadRequest("orphanDependents and propagationPolicy can't both be set")
+		}
+		if *options.OrphanDependents {
+			orphan := metav1.DeletePropagationOrphan
+			policy = &orphan
+		}
+	}
+	if policy == nil {
+		return nil
+	}
+
+	var finalizer string
+	switch *policy {
+	case metav1.DeletePropagationBackground:
+		return nil
+	case metav1.DeletePropagationForeground:
+		finalizer = metav1.FinalizerDeleteDependents
+	case metav1.DeletePropagationOrphan:
+		finalizer = metav1.FinalizerOrphanDependents
+	default:
+		return apierror.NewBadRequest(fmt.Sprintf("invalid propagationPolicy %q", *policy))
+	}
+	if !collected {
+		return apierror.NewBadRequest(fmt.Sprintf("propagationPolicy %q requires a garbage collector, none is running", *policy))
+	}
+	if !slices.Contains(obj.GetFinalizers(), finalizer) {
+		obj.SetFinalizers(append(obj.GetFinalizers(), finalizer))
+	}
+	return nil
 }
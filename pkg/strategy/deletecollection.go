@@ -0,0 +1,140 @@
+package strategy
+
+import (
+	"context"
+
+	"github.com/obot-platform/kinm/pkg/types"
+	apierror "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/registry/rest"
+	"k8s.io/apiserver/pkg/storage"
+)
+
+// deleteEachPageSize is the number of objects listed at a time by DeleteEach.
+const deleteEachPageSize = 500
+
+// PrepareDeleteFunc returns obj ready to be deleted by a DeleteCollection, or nil if it is not deleted, for instance
+// because it is already being deleted. It returns an error if obj can't be deleted, which fails the DeleteCollection.
+type PrepareDeleteFunc func(ctx context.Context, obj types.Object) (types.Object, error)
+
+// CollectionDeleter deletes the objects of a namespace, or of every namespace if it is empty, that match the
+// predicate of opts. Each object is passed to prepare before it is deleted, like it would be by Delete, objects with
+// finalizers are only marked as being deleted. It returns the deleted objects.
+type CollectionDeleter interface {
+	DeleteCollection(ctx context.Context, namespace string, opts storage.ListOptions, prepare PrepareDeleteFunc) (types.ObjectList, error)
+}
+
+// ListDeleter lists the objects of a DeleteCollectionAdapter and deletes them.
+type ListDeleter interface {
+	Lister
+	Deleter
+}
+
+var _ rest.CollectionDeleter = (*DeleteCollectionAdapter)(nil)
+
+// DeleteCollectionAdapter deletes the objects that match a list request. The strategy of the DeleteAdapter deletes
+// them if it implements CollectionDeleter, otherwise they are listed and deleted one at a time.
+type DeleteCollectionAdapter struct {
+	delete *DeleteAdapter
+	list   *ListAdapter
+}
+
+func NewDeleteCollection(deleteAdapter *DeleteAdapter, listAdapter *ListAdapter) *DeleteCollectionAdapter {
+	return &DeleteCollectionAdapter{
+		delete: deleteAdapter,
+		list:   listAdapter,
+	}
+}
+
+func (a *DeleteCollectionAdapter) DeleteCollection(ctx context.Context, deleteValidation rest.ValidateObjectFunc, options *metav1.DeleteOptions, listOptions *metainternalversion.ListOptions) (runtime.Object, error) {
+	// support older consumers of delete by treating "nil" as delete immediately
+	if options == nil {
+		options = metav1.NewDeleteOptions(0)
+	}
+
+	label := labels.Everything()
+	if listOptions != nil && listOptions.LabelSelector != nil {
+		label = listOptions.LabelSelector
+	}
+	field := fields.Everything()
+	if listOptions != nil && listOptions.FieldSelector != nil {
+		field = listOptions.FieldSelector
+	}
+
+	ns, _ := genericapirequest.NamespaceFrom(ctx)
+	opts := storage.ListOptions{
+		Predicate: a.list.predicate(label, field),
+	}
+	prepare := func(ctx context.Context, obj types.Object) (types.Object, error) {
+		// The grace period of options is defaulted for each object
+		if ok, err := a.delete.prepareDelete(ctx, obj, deleteValidation, options.DeepCopy()); err != nil || !ok {
+			return nil, err
+		}
+		return obj, nil
+	}
+
+	var (
+		result types.ObjectList
+		err    error
+	)
+	if len(options.DryRun) != 0 && options.DryRun[0] == metav1.DryRunAll {
+		result, err = DeleteEach(ctx, a.list.strategy, func(_ context.Context, obj types.Object) (types.Object, error) {
+			return obj, nil
+		}, ns, opts, prepare)
+	} else if o, ok := a.delete.strategy.(CollectionDeleter); ok {
+		result, err = o.DeleteCollection(ctx, ns, opts, prepare)
+	} else {
+		result, err = DeleteEach(ctx, a.list.strategy, a.delete.strategy.Delete, ns, opts, prepare)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// DeleteEach implements CollectionDeleter with the List of lister and deleteFunc, it deletes the matching objects one
+// at a time. Objects that are already gone are skipped.
+func DeleteEach(ctx context.Context, lister Lister, deleteFunc func(ctx context.Context, obj types.Object) (types.Object, error), namespace string, opts storage.ListOptions, prepare PrepareDeleteFunc) (types.ObjectList, error) {
+	var deleted []runtime.Object
+
+	opts.Predicate.Limit = deleteEachPageSize
+	for {
+		list, err := lister.List(ctx, namespace, opts)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := meta.EachListItem(list, func(item runtime.Object) error {
+			obj, err := prepare(ctx, item.(types.Object))
+			if err != nil || obj == nil {
+				return err
+			}
+			obj, err = deleteFunc(ctx, obj)
+			if apierror.IsNotFound(err) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if obj != nil {
+				deleted = append(deleted, obj)
+			}
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+
+		if list.GetContinue() == "" {
+			break
+		}
+		opts.Predicate.Continue = list.GetContinue()
+	}
+
+	result := lister.NewList()
+	return result, meta.SetList(result, deleted)
+}
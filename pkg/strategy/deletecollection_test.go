@@ -0,0 +1,90 @@
+package strategy_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/obot-platform/kinm/pkg/strategy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metainternalversion "k8s.io/apimachinery/pkg/apis/meta/internalversion"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ktypes "k8s.io/apimachinery/pkg/types"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/storage"
+)
+
+func TestDeleteCollection(t *testing.T) {
+	s, scheme := newStrategy(t)
+	adapter := strategy.NewDeleteCollection(strategy.NewDelete(scheme, s), strategy.NewList(s))
+	deleteCtx := genericapirequest.WithNamespace(ctx, "default")
+
+	// More objects than a batch, one of them with a finalizer
+	for i := range 150 {
+		obj := &StatusKind{ObjectMeta: metav1.ObjectMeta{
+			Name:      "delete" + strconv.Itoa(i),
+			Namespace: "default",
+			UID:       ktypes.UID("deleteuid" + strconv.Itoa(i)),
+			Labels:    map[string]string{"app": "delete"},
+		}}
+		if i == 0 {
+			obj.Finalizers = []string{"test/finalizer"}
+		}
+		_, err := s.Create(ctx, obj)
+		require.NoError(t, err)
+	}
+	_, err := s.Create(ctx, &StatusKind{ObjectMeta: metav1.ObjectMeta{
+		Name:      "keep",
+		Namespace: "default",
+		UID:       "keepuid",
+		Labels:    map[string]string{"app": "keep"},
+	}})
+	require.NoError(t, err)
+
+	selector := &metainternalversion.ListOptions{LabelSelector: labels.SelectorFromSet(labels.Set{"app": "delete"})}
+	count := func() int {
+		t.Helper()
+		list, err := s.List(ctx, "default", storage.ListOptions{})
+		require.NoError(t, err)
+		return len(list.(*StatusKindList).Items)
+	}
+
+	// A dry run deletes nothing
+	result, err := adapter.DeleteCollection(deleteCtx, nil, &metav1.DeleteOptions{DryRun: []string{metav1.DryRunAll}}, selector)
+	require.NoError(t, err)
+	assert.Len(t, result.(*StatusKindList).Items, 150)
+	assert.Equal(t, 151, count())
+
+	// A failed validation deletes nothing in its batch
+	_, err = adapter.DeleteCollection(deleteCtx, func(context.Context, runtime.Object) error {
+		return apierrors.NewForbidden(schema.GroupResource{}, "", nil)
+	}, nil, selector)
+	assert.True(t, apierrors.IsForbidden(err))
+	assert.Equal(t, 151, count())
+
+	result, err = adapter.DeleteCollection(deleteCtx, nil, nil, selector)
+	require.NoError(t, err)
+	assert.Len(t, result.(*StatusKindList).Items, 150)
+
+	// The object with a finalizer is only marked as deleted
+	list, err := s.List(ctx, "default", storage.ListOptions{})
+	require.NoError(t, err)
+	var names []string
+	for _, obj := range list.(*StatusKindList).Items {
+		names = append(names, obj.Name)
+		if obj.Name == "delete0" {
+			assert.NotNil(t, obj.DeletionTimestamp)
+		}
+	}
+	assert.ElementsMatch(t, []string{"delete0", "keep"}, names)
+
+	// Objects that are already being deleted are not deleted again
+	result, err = adapter.DeleteCollection(deleteCtx, nil, nil, selector)
+	require.NoError(t, err)
+	assert.Empty(t, result.(*StatusKindList).Items)
+}
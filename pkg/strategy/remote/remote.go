@@ -18,7 +18,8 @@ import (
 )
 
 var (
-	_ strategy.CompleteStrategy = (*Remote)(nil)
+	_ strategy.CompleteStrategy  = (*Remote)(nil)
+	_ strategy.CollectionDeleter = (*Remote)(nil)
 
 	tracer = otel.Tracer("kinm/remote")
 )
@@ -106,6 +107,15 @@ func (r *Remote) Delete(ctx context.Context, obj types.Object) (types.Object, er
 	return obj, r.c.Delete(ctx, obj)
 }
 
+// DeleteCollection lists the matching objects of the remote cluster and deletes them one at a time, so that prepare
+// is called on each of them.
+func (r *Remote) DeleteCollection(ctx context.Context, namespace string, opts storage.ListOptions, prepare strategy.PrepareDeleteFunc) (types.ObjectList, error) {
+	ctx, span := kotel.StartSpanIfParent(ctx, tracer, "deleteCollection", trace.WithAttributes(kotel.ListOptionsToAttributes(opts, attribute.String("gvk", r.gvk.String()), attribute.String("namespace", namespace))...))
+	defer span.End()
+
+	return strategy.DeleteEach(ctx, r, r.Delete, namespace, opts, prepare)
+}
+
 func (r *Remote) Watch(ctx context.Context, namespace string, opts storage.ListOptions) (<-chan watch.Event, error) {
 	ctx, span := kotel.StartSpanIfParent(ctx, tracer, "watch", trace.WithAttributes(kotel.ListOptionsToAttributes(opts, attribute.String("gvk", r.gvk.String()), attribute.String("namespace", namespace))...))
 	defer span.End()
@@ -8,6 +8,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apiserver/pkg/registry/rest"
+	"sigs.k8s.io/structured-merge-diff/v6/fieldpath"
 )
 
 var _ rest.Storage = (*Status)(nil)
@@ -28,10 +29,7 @@ type Status struct {
 
 func NewStatus(scheme *runtime.Scheme, strategy StatusUpdater) *Status {
 	return &Status{
-		update: &UpdateAdapter{
-			CreateAdapter: NewCreate(scheme, strategy),
-			strategy:      strategy,
-		},
+		update:                NewUpdateStatus(scheme, strategy),
 		get:                   NewGet(strategy),
 		strategy:              strategy,
 		defaultTableConverter: rest.NewDefaultTableConvertor(schema.GroupResource{}),
@@ -53,6 +51,10 @@ func (s *Status) Update(ctx context.Context, name string, objInfo rest.UpdatedOb
 	return s.update.update(ctx, true, name, objInfo, createValidation, updateValidation, false, options)
 }
 
+func (s *Status) GetResetFieldsFilter() map[fieldpath.APIVersion]fieldpath.Filter {
+	return s.update.GetResetFieldsFilter()
+}
+
 func (s *Status) ConvertToTable(ctx context.Context, object runtime.Object, tableOptions runtime.Object) (*metav1.Table, error) {
 	if o, ok := s.strategy.(rest.TableConvertor); ok {
 		return o.ConvertToTable(ctx, object, tableOptions)
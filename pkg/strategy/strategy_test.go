@@ -0,0 +1,82 @@
+package strategy_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/obot-platform/kinm/pkg/db"
+	"github.com/obot-platform/kinm/pkg/strategy"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	ctx = context.Background()
+
+	testGV = schema.GroupVersion{
+		Group:   "testgroup",
+		Version: "testversion",
+	}
+)
+
+type StatusKind struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              string `json:"spec,omitempty"`
+	Status            string `json:"status,omitempty"`
+}
+
+func (s *StatusKind) DeepCopyObject() runtime.Object {
+	return &StatusKind{
+		TypeMeta:   s.TypeMeta,
+		ObjectMeta: *s.ObjectMeta.DeepCopy(),
+		Spec:       s.Spec,
+		Status:     s.Status,
+	}
+}
+
+func (s *StatusKind) ResetStatus(old runtime.Object) {
+	s.Status = old.(*StatusKind).Status
+}
+
+func (s *StatusKind) ResetSpec(old runtime.Object) {
+	status := s.Status
+	*s = *old.DeepCopyObject().(*StatusKind)
+	s.Status = status
+}
+
+type StatusKindList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []StatusKind `json:"items"`
+}
+
+func (s *StatusKindList) DeepCopyObject() runtime.Object {
+	result := &StatusKindList{
+		TypeMeta: s.TypeMeta,
+		ListMeta: *s.ListMeta.DeepCopy(),
+	}
+	for _, item := range s.Items {
+		result.Items = append(result.Items, *item.DeepCopyObject().(*StatusKind))
+	}
+	return result
+}
+
+// newStrategy returns the database strategy of StatusKind, in a database of its own, and its scheme.
+func newStrategy(t *testing.T) (strategy.CompleteStrategy, *runtime.Scheme) {
+	t.Helper()
+
+	scheme := runtime.NewScheme()
+	scheme.AddKnownTypes(testGV, &StatusKind{}, &StatusKindList{})
+
+	f, err := db.NewFactory(scheme, "sqlite://"+filepath.Join(t.TempDir(), "kinm.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = f.Close() })
+	s, err := f.NewDBStrategy(&StatusKind{})
+	require.NoError(t, err)
+	t.Cleanup(s.Destroy)
+	return s, scheme
+}
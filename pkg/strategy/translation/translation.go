@@ -21,7 +21,8 @@ import (
 )
 
 var (
-	_ strategy.CompleteStrategy = (*Strategy)(nil)
+	_ strategy.CompleteStrategy  = (*Strategy)(nil)
+	_ strategy.CollectionDeleter = (*Strategy)(nil)
 
 	tracer = otel.Tracer("kinm/translation")
 )
@@ -240,6 +241,38 @@ func (t *Strategy) Delete(ctx context.Context, obj types.Object) (types.Object,
 	return deletedObj, err
 }
 
+// DeleteCollection deletes the objects that match opts with the translated strategy, if it implements
+// strategy.CollectionDeleter, or one at a time otherwise. prepare is called with the public objects.
+func (t *Strategy) DeleteCollection(ctx context.Context, namespace string, opts storage.ListOptions, prepare strategy.PrepareDeleteFunc) (types.ObjectList, error) {
+	ctx, span := kotel.StartSpanLevelIfParent(ctx, tracer, kotel.LevelVerbose, "translateDeleteCollection", trace.WithAttributes(kotel.ListOptionsToAttributes(opts, attribute.String("gvk", t.pubGVK.String()), attribute.String("namespace", namespace))...))
+	defer span.End()
+
+	deleter, ok := t.strategy.(strategy.CollectionDeleter)
+	if !ok {
+		return strategy.DeleteEach(ctx, t, t.Delete, namespace, opts, prepare)
+	}
+
+	namespace, opts, err := t.translateListOpts(ctx, namespace, opts)
+	if err != nil {
+		return nil, err
+	}
+	o, err := deleter.DeleteCollection(ctx, namespace, opts, func(ctx context.Context, obj types.Object) (types.Object, error) {
+		objs, err := t.toPublicObjects(ctx, obj)
+		if err != nil || len(objs) == 0 {
+			return nil, err
+		}
+		pubObj, err := prepare(ctx, objs[0])
+		if err != nil || pubObj == nil {
+			return nil, err
+		}
+		return t.fromPublic(ctx, pubObj)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t.toPublicList(ctx, o)
+}
+
 func (t *Strategy) translateListOpts(ctx context.Context, namespace string, opts storage.ListOptions) (string, storage.ListOptions, error) {
 	if opts.Predicate.Field != nil {
 		var err error
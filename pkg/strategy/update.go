@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/obot-platform/kinm/pkg/types"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -13,6 +14,7 @@ import (
 	"k8s.io/apiserver/pkg/endpoints/request"
 	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
 	"k8s.io/apiserver/pkg/registry/rest"
+	"sigs.k8s.io/structured-merge-diff/v6/fieldpath"
 )
 
 type PrepareForUpdater interface {
@@ -39,7 +41,10 @@ type updaterCommon interface {
 	Creater
 }
 
-var _ rest.Updater = (*UpdateAdapter)(nil)
+var (
+	_ rest.Updater                   = (*UpdateAdapter)(nil)
+	_ rest.ResetFieldsFilterStrategy = (*UpdateAdapter)(nil)
+)
 
 type UpdateAdapter struct {
 	*CreateAdapter
@@ -152,6 +157,8 @@ func (a *UpdateAdapter) update(ctx context.Context, status bool, name string, ob
 		return newObj, true, err
 	}
 
+	resetSubresource(status, obj, existing)
+
 	if err := rest.BeforeUpdate(a, ctx, obj, existing); err != nil {
 		return nil, false, err
 	}
@@ -164,6 +171,12 @@ func (a *UpdateAdapter) update(ctx context.Context, status bool, name string, ob
 		}
 	}
 
+	if unchanged(obj, existing) {
+		// Nothing is written, so that a no-op update, like a server-side apply of the same configuration again, does
+		// not change the resource version
+		return existing, false, nil
+	}
+
 	if len(options.DryRun) != 0 && options.DryRun[0] == metav1.DryRunAll {
 		return obj, false, nil
 	}
@@ -177,6 +190,63 @@ func (a *UpdateAdapter) update(ctx context.Context, status bool, name string, ob
 	return newObj, false, err
 }
 
+// resetSubresource keeps the status of existing on an update of obj, or everything but its status on an update of
+// the status, if obj implements types.StatusResetter.
+func resetSubresource(status bool, obj, existing runtime.Object) {
+	o, ok := obj.(types.StatusResetter)
+	if !ok {
+		return
+	}
+	if !status {
+		o.ResetStatus(existing)
+		return
+	}
+
+	// The resource version of the update is checked against the stored object, and its managed fields are set by
+	// the field manager for the status, they are not reset
+	var (
+		resourceVersion = obj.(types.Object).GetResourceVersion()
+		managedFields   = obj.(types.Object).GetManagedFields()
+	)
+	o.ResetSpec(existing)
+	obj.(types.Object).SetResourceVersion(resourceVersion)
+	obj.(types.Object).SetManagedFields(managedFields)
+}
+
+// unchanged returns true if obj is the same as existing, ignoring their type meta.
+func unchanged(obj, existing runtime.Object) bool {
+	obj, existing = obj.DeepCopyObject(), existing.DeepCopyObject()
+	obj.GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{})
+	existing.GetObjectKind().SetGroupVersionKind(schema.GroupVersionKind{})
+	return equality.Semantic.DeepEqual(obj, existing)
+}
+
+// GetResetFieldsFilter returns the fields that an update can change, for the managed fields of server-side apply.
+// If the object implements types.StatusResetter, an update of the object can't change its status, and an update of
+// its status can't change anything else, so that the manager of the status and the manager of the spec don't
+// conflict.
+func (a *UpdateAdapter) GetResetFieldsFilter() map[fieldpath.APIVersion]fieldpath.Filter {
+	obj := a.strategy.New()
+	if _, ok := obj.(types.StatusResetter); !ok {
+		return nil
+	}
+	gvks, _, err := a.ObjectKinds(obj)
+	if err != nil {
+		return nil
+	}
+
+	filter := fieldpath.NewExcludeSetFilter(fieldpath.NewSet(fieldpath.MakePathOrDie("status")))
+	if a.status {
+		filter = fieldpath.NewIncludeMatcherFilter(fieldpath.MakePrefixMatcherOrDie("status"))
+	}
+
+	result := map[fieldpath.APIVersion]fieldpath.Filter{}
+	for _, gvk := range gvks {
+		result[fieldpath.APIVersion(gvk.GroupVersion().String())] = filter
+	}
+	return result
+}
+
 func (a *UpdateAdapter) qualifiedResourceFromContext(ctx context.Context) schema.GroupResource {
 	if info, ok := genericapirequest.RequestInfoFrom(ctx); ok {
 		return schema.GroupResource{Group: info.APIGroup, Resource: info.Resource}
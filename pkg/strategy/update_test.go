@@ -0,0 +1,140 @@
+package strategy_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/obot-platform/kinm/pkg/strategy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/managedfields"
+	genericapirequest "k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/apiserver/pkg/registry/rest"
+)
+
+func TestUpdateStatusSubresource(t *testing.T) {
+	s, schema := newStrategy(t)
+
+	obj, err := s.Create(ctx, &StatusKind{
+		ObjectMeta: metav1.ObjectMeta{Name: "test", Namespace: "default", UID: "testuid"},
+		Spec:       "spec",
+		Status:     "status",
+	})
+	require.NoError(t, err)
+
+	updateCtx := genericapirequest.WithNamespace(ctx, "default")
+	update := func(adapter rest.Updater, obj *StatusKind) *StatusKind {
+		t.Helper()
+		result, _, err := adapter.Update(updateCtx, obj.Name, rest.DefaultUpdatedObjectInfo(obj), nil, nil, false, &metav1.UpdateOptions{})
+		require.NoError(t, err)
+		return result.(*StatusKind)
+	}
+
+	// An update of the object keeps its status
+	changed := obj.DeepCopyObject().(*StatusKind)
+	changed.Spec = "newspec"
+	changed.Status = "ignored"
+	updated := update(strategy.NewUpdate(schema, s), changed)
+	assert.Equal(t, "newspec", updated.Spec)
+	assert.Equal(t, "status", updated.Status)
+
+	// An update of the status keeps everything else
+	changed = updated.DeepCopyObject().(*StatusKind)
+	changed.Spec = "ignored"
+	changed.Labels = map[string]string{"ignored": "true"}
+	changed.Status = "newstatus"
+	updated = update(strategy.NewStatus(schema, s), changed)
+	assert.Equal(t, "newspec", updated.Spec)
+	assert.Empty(t, updated.Labels)
+	assert.Equal(t, "newstatus", updated.Status)
+
+	// The resource version of a status update is still checked
+	changed.ResourceVersion = obj.GetResourceVersion()
+	_, _, err = strategy.NewStatus(schema, s).Update(updateCtx, changed.Name, rest.DefaultUpdatedObjectInfo(changed), nil, nil, false, &metav1.UpdateOptions{})
+	assert.True(t, apierrors.IsConflict(err))
+}
+
+// applyInfo applies patch to the stored object with the field manager, like an apply patch request.
+type applyInfo struct {
+	fieldManager *managedfields.FieldManager
+	patch        *unstructured.Unstructured
+	manager      string
+	force        bool
+}
+
+func (a applyInfo) Preconditions() *metav1.Preconditions {
+	return nil
+}
+
+func (a applyInfo) UpdatedObject(_ context.Context, old runtime.Object) (runtime.Object, error) {
+	return a.fieldManager.Apply(old, a.patch, a.manager, a.force)
+}
+
+func TestServerSideApply(t *testing.T) {
+	s, schema := newStrategy(t)
+	gvk := testGV.WithKind("StatusKind")
+
+	updateCtx := genericapirequest.WithNamespace(ctx, "default")
+	apply := func(adapter rest.ResetFieldsFilterStrategy, subresource, manager string, force bool, fields map[string]any) (*StatusKind, error) {
+		t.Helper()
+		fieldManager, err := managedfields.NewDefaultFieldManager(managedfields.NewDeducedTypeConverter(), schema, schema, schema,
+			gvk, gvk.GroupVersion(), subresource, adapter.GetResetFieldsFilter())
+		require.NoError(t, err)
+
+		patch := &unstructured.Unstructured{Object: fields}
+		patch.SetGroupVersionKind(gvk)
+		patch.SetName("test")
+		patch.SetNamespace("default")
+		result, _, err := adapter.(rest.Updater).Update(updateCtx, "test", applyInfo{
+			fieldManager: fieldManager,
+			patch:        patch,
+			manager:      manager,
+			force:        force,
+		}, nil, nil, true, &metav1.UpdateOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return result.(*StatusKind), nil
+	}
+	managers := func(obj *StatusKind) (result []string) {
+		for _, entry := range obj.ManagedFields {
+			result = append(result, entry.Manager)
+		}
+		return
+	}
+
+	update, status := strategy.NewUpdate(schema, s), strategy.NewStatus(schema, s)
+
+	// An apply creates the object, its status is not managed by the update
+	obj, err := apply(update, "", "user", false, map[string]any{"spec": "spec", "status": "ignored"})
+	require.NoError(t, err)
+	assert.Equal(t, "spec", obj.Spec)
+	assert.Equal(t, []string{"user"}, managers(obj))
+	assert.NotContains(t, string(obj.ManagedFields[0].FieldsV1.Raw), "status")
+
+	// Applying the same configuration again writes nothing
+	again, err := apply(update, "", "user", false, map[string]any{"spec": "spec"})
+	require.NoError(t, err)
+	assert.Equal(t, obj.ResourceVersion, again.ResourceVersion)
+
+	// The status is managed separately, it does not conflict with the spec
+	obj, err = apply(status, "status", "controller", false, map[string]any{"spec": "ignored", "status": "ready"})
+	require.NoError(t, err)
+	assert.Equal(t, "spec", obj.Spec)
+	assert.Equal(t, "ready", obj.Status)
+	assert.ElementsMatch(t, []string{"user", "controller"}, managers(obj))
+
+	// Another manager conflicts with the manager of the spec, unless forced
+	_, err = apply(update, "", "other", false, map[string]any{"spec": "other"})
+	assert.True(t, apierrors.IsConflict(err))
+
+	obj, err = apply(update, "", "other", true, map[string]any{"spec": "other"})
+	require.NoError(t, err)
+	assert.Equal(t, "other", obj.Spec)
+	assert.Equal(t, "ready", obj.Status)
+	assert.ElementsMatch(t, []string{"controller", "other"}, managers(obj))
+}
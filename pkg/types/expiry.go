@@ -0,0 +1,15 @@
+package types
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ExpiresAtAnnotation sets the time, in RFC 3339 format, after which an object is deleted. It is only used if the
+// object does not implement Expirer.
+const ExpiresAtAnnotation = "kinm.obot.ai/expires-at"
+
+// Expirer is implemented by objects that are deleted once they expire.
+type Expirer interface {
+	// ExpiresAt returns the time after which the object is deleted, or nil if it does not expire.
+	ExpiresAt() *metav1.Time
+}
@@ -0,0 +1,10 @@
+package types
+
+import "k8s.io/apimachinery/pkg/runtime"
+
+// SpecChanger is implemented by objects that decide which of their changes bump their generation. By default, the
+// generation of an object is bumped by an update that changes anything but its metadata and status.
+type SpecChanger interface {
+	// SpecChanged returns true if the object changed from old in a way that bumps its generation.
+	SpecChanged(old runtime.Object) bool
+}
@@ -0,0 +1,9 @@
+package types
+
+// GracefulDeleter is implemented by objects that are deleted gracefully. Once deleted, they keep being visible, with
+// their deletion timestamp in the future, until their grace period ends or they are deleted again with a shorter
+// one. Objects that don't implement it are deleted immediately, whatever grace period is requested.
+type GracefulDeleter interface {
+	// DefaultGracePeriodSeconds returns the grace period of a delete that does not request one.
+	DefaultGracePeriodSeconds() int64
+}
@@ -0,0 +1,65 @@
+package types
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// NamespaceFinalizer is set on every Namespace, it is removed by the namespace controller once the contents of the
+// namespace are deleted.
+const NamespaceFinalizer = "kinm.obot.ai/namespace"
+
+// NamespacePhase is the lifecycle phase of a Namespace.
+type NamespacePhase string
+
+const (
+	// NamespaceActive is the phase of a namespace that objects can be created in.
+	NamespaceActive NamespacePhase = "Active"
+	// NamespaceTerminating is the phase of a namespace that is being deleted. Objects can't be created in it
+	// anymore, and its contents are being deleted.
+	NamespaceTerminating NamespacePhase = "Terminating"
+)
+
+// Namespace is a built-in kind for the namespaces of namespaced kinds. It must be added to the scheme, in the group
+// of the API server, along with NamespaceList.
+type Namespace struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Status            NamespaceStatus `json:"status,omitempty"`
+}
+
+type NamespaceStatus struct {
+	Phase NamespacePhase `json:"phase,omitempty"`
+}
+
+func (n *Namespace) DeepCopyObject() runtime.Object {
+	return &Namespace{
+		TypeMeta:   n.TypeMeta,
+		ObjectMeta: *n.ObjectMeta.DeepCopy(),
+		Status:     n.Status,
+	}
+}
+
+func (*Namespace) NamespaceScoped() bool {
+	return false
+}
+
+type NamespaceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Namespace `json:"items"`
+}
+
+func (n *NamespaceList) DeepCopyObject() runtime.Object {
+	result := &NamespaceList{
+		TypeMeta: n.TypeMeta,
+		ListMeta: *n.ListMeta.DeepCopy(),
+	}
+	if n.Items != nil {
+		result.Items = make([]Namespace, len(n.Items))
+		for i := range n.Items {
+			result.Items[i] = *n.Items[i].DeepCopyObject().(*Namespace)
+		}
+	}
+	return result
+}
@@ -0,0 +1,71 @@
+package types
+
+import (
+	"maps"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// QuotaUsageName is the name of the QuotaUsage of every namespace.
+const QuotaUsageName = "usage"
+
+// QuotaResources are amounts of the resources of a namespace that are limited by quotas.
+type QuotaResources struct {
+	// Objects is the number of objects of each kind, by group/kind as formatted by schema.GroupKind, e.g.
+	// "Widget.example.com".
+	Objects map[string]int64 `json:"objects,omitempty"`
+	// Bytes is the total size of the stored objects of every kind.
+	Bytes int64 `json:"bytes,omitempty"`
+}
+
+func (q QuotaResources) DeepCopy() QuotaResources {
+	q.Objects = maps.Clone(q.Objects)
+	return q
+}
+
+// QuotaUsage is a read only kind with the usage and the limits of the quota of a namespace. It must be added to the
+// scheme, in the group of the API server, along with QuotaUsageList.
+type QuotaUsage struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Status            QuotaUsageStatus `json:"status,omitempty"`
+}
+
+type QuotaUsageStatus struct {
+	// Hard is the limits of the namespace, resources without a limit are omitted.
+	Hard QuotaResources `json:"hard,omitempty"`
+	// Used is the current usage of the namespace.
+	Used QuotaResources `json:"used,omitempty"`
+}
+
+func (q *QuotaUsage) DeepCopyObject() runtime.Object {
+	return &QuotaUsage{
+		TypeMeta:   q.TypeMeta,
+		ObjectMeta: *q.ObjectMeta.DeepCopy(),
+		Status: QuotaUsageStatus{
+			Hard: q.Status.Hard.DeepCopy(),
+			Used: q.Status.Used.DeepCopy(),
+		},
+	}
+}
+
+type QuotaUsageList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []QuotaUsage `json:"items"`
+}
+
+func (q *QuotaUsageList) DeepCopyObject() runtime.Object {
+	result := &QuotaUsageList{
+		TypeMeta: q.TypeMeta,
+		ListMeta: *q.ListMeta.DeepCopy(),
+	}
+	if q.Items != nil {
+		result.Items = make([]QuotaUsage, len(q.Items))
+		for i := range q.Items {
+			result.Items[i] = *q.Items[i].DeepCopyObject().(*QuotaUsage)
+		}
+	}
+	return result
+}
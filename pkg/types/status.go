@@ -0,0 +1,14 @@
+package types
+
+import "k8s.io/apimachinery/pkg/runtime"
+
+// StatusResetter is implemented by objects that split their spec and status, like the kinds of Kubernetes that
+// have a status subresource. An update of the object can't change its status, and an update of its status can't
+// change anything else.
+type StatusResetter interface {
+	// ResetStatus sets the status of the object to the status of old, on an update of the object.
+	ResetStatus(old runtime.Object)
+	// ResetSpec sets everything but the status of the object, including its metadata, to the values of old, on an
+	// update of its status. The resource version and the managed fields of the update are kept.
+	ResetSpec(old runtime.Object)
+}